@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bootstrapSeedJSON bool
+
+	cmdBootstrapSeed = &cobra.Command{
+		Use:   "bootstrap-seed [src:path]",
+		Short: "Suggest packages to stage-build to break every dependency cycle",
+		Long: `For every dependency cycle between source recipes, suggest a small set of
+packages that breaks all of the cycles among its members once they are left
+out. Building these packages first with reduced build dependencies makes the
+rest of the cycle buildable in order.
+
+For example: autobuild bootstrap-seed src:../packages
+
+This is a heuristic: the packages are picked greedily, preferring the ones with
+the most dependencies and dependents within the cycle, and then every package
+that turns out not to be needed is dropped again. No package of a suggested set
+can be left out, but a smaller set may exist. Self-dependencies are not
+considered, since they are not part of the graph.`,
+		RunE: runBootstrapSeed,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+// seedReport is a cycle and the packages suggested to break it, as printed by
+// bootstrap-seed with --json.
+type seedReport struct {
+	Packages []string `json:"packages"`
+	Seed     []string `json:"seed"`
+}
+
+func init() {
+	cmdBootstrapSeed.Flags().BoolVar(&bootstrapSeedJSON, "json", false, "print the cycles and their suggested seeds as JSON")
+}
+
+// cycleDeps returns the dependencies of every member of `cycle` that are
+// members of it as well.
+func cycleDeps(graphData depgraph.GraphData, cycle []string) map[string][]string {
+	deps := make(map[string][]string, len(cycle))
+	for _, edge := range graphData.Edges {
+		if slices.Contains(cycle, edge.Source) && slices.Contains(cycle, edge.Target) {
+			deps[edge.Source] = append(deps[edge.Source], edge.Target)
+		}
+	}
+	return deps
+}
+
+// acyclicPart removes the members of `remaining` that can't be part of a
+// cycle anymore, i.e. that have no dependencies or no dependents left, until
+// none are left to remove. Only members that are part of cycles remain.
+func acyclicPart(deps map[string][]string, remaining map[string]bool) {
+	for changed := true; changed; {
+		changed = false
+		in, out := degreesWithin(deps, remaining)
+		for name := range remaining {
+			if in[name] == 0 || out[name] == 0 {
+				delete(remaining, name)
+				changed = true
+			}
+		}
+	}
+}
+
+// degreesWithin counts the dependents and dependencies of the `remaining`
+// members among themselves.
+func degreesWithin(deps map[string][]string, remaining map[string]bool) (in map[string]int, out map[string]int) {
+	in, out = make(map[string]int), make(map[string]int)
+	for name := range remaining {
+		for _, dep := range deps[name] {
+			if remaining[dep] {
+				out[name]++
+				in[dep]++
+			}
+		}
+	}
+	return
+}
+
+// isAcyclicWithout reports whether `cycle` has no cycles left once the
+// packages in `seed` are left out.
+func isAcyclicWithout(deps map[string][]string, cycle []string, seed []string) bool {
+	remaining := make(map[string]bool, len(cycle))
+	for _, name := range cycle {
+		if !slices.Contains(seed, name) {
+			remaining[name] = true
+		}
+	}
+	acyclicPart(deps, remaining)
+	return len(remaining) == 0
+}
+
+// bootstrapSeed returns a set of members of `cycle`, sorted, that breaks all
+// of its cycles when left out. Members are picked greedily by the product of
+// their dependents and dependencies within what remains of the cycle, ties
+// being broken by name, and are then dropped again if the others suffice.
+func bootstrapSeed(deps map[string][]string, cycle []string) (seed []string) {
+	remaining := make(map[string]bool, len(cycle))
+	for _, name := range cycle {
+		remaining[name] = true
+	}
+
+	for acyclicPart(deps, remaining); len(remaining) > 0; acyclicPart(deps, remaining) {
+		in, out := degreesWithin(deps, remaining)
+		best, bestScore := "", -1
+		for name := range remaining {
+			if score := in[name] * out[name]; score > bestScore || (score == bestScore && name < best) {
+				best, bestScore = name, score
+			}
+		}
+		seed = append(seed, best)
+		delete(remaining, best)
+	}
+
+	// Drop the packages that later picks made unnecessary, latest first
+	for idx := len(seed) - 1; idx >= 0; idx-- {
+		without := slices.Delete(slices.Clone(seed), idx, idx+1)
+		if isAcyclicWithout(deps, cycle, without) {
+			seed = without
+		}
+	}
+
+	slices.Sort(seed)
+	return
+}
+
+func runBootstrapSeed(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	if bootstrapSeedJSON {
+		waterlog.SetOutput(os.Stderr)
+	}
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	reports := make([]seedReport, 0)
+	for _, cycle := range findCycles(gi) {
+		reports = append(reports, seedReport{
+			Packages: cycle,
+			Seed:     bootstrapSeed(cycleDeps(gi.data, cycle), cycle),
+		})
+	}
+
+	if bootstrapSeedJSON {
+		out, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	if len(reports) == 0 {
+		waterlog.Goodln("No dependency cycles found!")
+		return nil
+	}
+	for idx, report := range reports {
+		waterlog.Infof("Cycle %d: ", idx+1)
+		fmt.Println(strings.Join(report.Packages, " "))
+		fmt.Printf("  Break at: %s\n", strings.Join(report.Seed, " "))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/spf13/cobra"
+	"github.com/yourbasic/graph"
+)
+
+// exitCycles is the exit status used when a command cannot complete because
+// the dependency graph has cycles.
+const exitCycles = 2
+
+var (
+	cmdBuildOrder = &cobra.Command{
+		Use:   "build-order [src:path]",
+		Short: "Print a deterministic build order of all source recipes",
+		Long: `Print every source recipe, one per line, in an order where dependencies
+always come before their dependents.
+
+For example: autobuild build-order src:../packages
+
+Ties are broken alphabetically, so the output is reproducible across runs. Only
+the order is printed to stdout; everything else goes to stderr. If cycles
+prevent a full ordering, the remaining cycles are printed to stderr and the
+command exits with status 2.`,
+		RunE: runBuildOrder,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+// buildOrder returns the vertices of the graph with dependencies before
+// dependents, breaking ties by node ID.
+func buildOrder(gi *graphIndex) ([]int, bool) {
+	return utils.LexTopSort(graph.Transpose(gi.g), func(a, b int) int {
+		return strings.Compare(gi.data.Nodes[a].ID, gi.data.Nodes[b].ID)
+	})
+}
+
+func runBuildOrder(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	waterlog.SetOutput(os.Stderr)
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	order, ok := buildOrder(gi)
+	for _, name := range gi.names(order) {
+		fmt.Println(name)
+	}
+
+	if !ok {
+		waterlog.Errorf("%d package(s) could not be ordered due to cycles:\n", len(gi.data.Nodes)-len(order))
+		for cycleIdx, cycle := range findCycles(gi) {
+			waterlog.Errorf("Cycle %d: ", cycleIdx+1)
+			fmt.Fprintln(os.Stderr, strings.Join(cycle, " "))
+		}
+		return exitStatus(exitCycles)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/GZGavinZhao/autobuild/depgraph"
+)
+
+// testGraphIndex indexes a graph with the given nodes, where every edge is a
+// [dependent, dependency] pair.
+func testGraphIndex(nodes []string, edges [][2]string) *graphIndex {
+	var data depgraph.GraphData
+	for _, node := range nodes {
+		data.Nodes = append(data.Nodes, depgraph.GraphNode{ID: node})
+	}
+	for _, edge := range edges {
+		data.Edges = append(data.Edges, depgraph.GraphEdge{Source: edge[0], Target: edge[1], Kind: depgraph.EdgeBuild})
+	}
+	return newGraphIndex(data)
+}
+
+func TestBuildOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []string
+		edges [][2]string
+		want  []string
+		ok    bool
+	}{
+		{
+			name:  "alphabetical without dependencies",
+			nodes: []string{"zlib", "bash", "glibc"},
+			want:  []string{"bash", "glibc", "zlib"},
+			ok:    true,
+		},
+		{
+			name:  "dependencies first",
+			nodes: []string{"bash", "glibc", "readline"},
+			edges: [][2]string{{"bash", "readline"}, {"readline", "glibc"}},
+			want:  []string{"glibc", "readline", "bash"},
+			ok:    true,
+		},
+		{
+			name:  "ties broken by id",
+			nodes: []string{"zsh", "bash", "ncurses", "glibc"},
+			edges: [][2]string{{"zsh", "ncurses"}, {"bash", "ncurses"}, {"ncurses", "glibc"}},
+			want:  []string{"glibc", "ncurses", "bash", "zsh"},
+			ok:    true,
+		},
+		{
+			name:  "cycle",
+			nodes: []string{"a", "b", "c", "d"},
+			edges: [][2]string{{"a", "b"}, {"b", "a"}, {"c", "a"}},
+			want:  []string{"d"},
+			ok:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gi := testGraphIndex(tt.nodes, tt.edges)
+			order, ok := buildOrder(gi)
+			if got := gi.names(order); !slices.Equal(got, tt.want) || ok != tt.ok {
+				t.Errorf("buildOrder() = %v, %t, want %v, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
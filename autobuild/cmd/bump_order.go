@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bumpOrderJSON bool
+
+	cmdBumpOrder = &cobra.Command{
+		Use:   "bump-order [src:path] [package]",
+		Short: "Print the order to rebuild a package and its dependents in",
+		Long: `Print the given source recipe and every recipe that transitively
+build-depends on it, one per line, in an order where dependencies always come
+before their dependents. This is the order to rebuild them in after bumping the
+package.
+
+For example: autobuild bump-order src:../packages rocm-cmake
+
+Ties are broken alphabetically, as in build-order. The package can be given as
+a shell-style glob, as a regular expression with --regex, or as "-" to read the
+packages from stdin, in which case all of them and their dependents are
+ordered together. If cycles prevent a full ordering, the remaining cycles are
+printed to stderr and the command exits with status 2.`,
+		RunE: runBumpOrder,
+		Args: cobra.ExactArgs(2),
+	}
+)
+
+// bumpOrderReport is the output of bump-order with --json.
+type bumpOrderReport struct {
+	Package string   `json:"package"`
+	Order   []string `json:"order"`
+}
+
+func init() {
+	cmdBumpOrder.Flags().BoolVar(&bumpOrderJSON, "json", false, "print the order as JSON")
+	selectFlagsInit(cmdBumpOrder)
+}
+
+func runBumpOrder(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	name := args[1]
+	waterlog.SetOutput(os.Stderr)
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	starts, err := selectPackages(gi, []string{name})
+	if err != nil {
+		return err
+	}
+	keep := gi.reachable(starts, -1, true)
+	affected := newGraphIndex(gi.data.Subgraph(func(node depgraph.GraphNode) bool { return keep[gi.ids[node.ID]] }))
+
+	order, ok := buildOrder(affected)
+	names := affected.names(order)
+	if bumpOrderJSON {
+		out, err := json.MarshalIndent(bumpOrderReport{Package: name, Order: names}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	}
+
+	if !ok {
+		waterlog.Errorf("%d package(s) could not be ordered due to cycles:\n", len(affected.data.Nodes)-len(order))
+		for cycleIdx, cycle := range findCycles(affected) {
+			waterlog.Errorf("Cycle %d: ", cycleIdx+1)
+			fmt.Fprintln(os.Stderr, strings.Join(cycle, " "))
+		}
+		return exitStatus(exitCycles)
+	}
+	return nil
+}
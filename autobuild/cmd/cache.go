@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/ypkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdCache = &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cache of parsed package.yml files",
+		Long: `Manage the cache of parsed package.yml files.
+
+Parsed package.yml files are cached under $XDG_CACHE_HOME/autobuild and reused
+as long as the modification time and size of the file stay the same. Pass
+--no-cache to any command to bypass the cache.`,
+	}
+
+	cmdCacheClear = &cobra.Command{
+		Use:   "clear",
+		Short: "Remove every cached package.yml",
+		RunE:  runCacheClear,
+		Args:  cobra.NoArgs,
+	}
+)
+
+func init() {
+	cmdCache.AddCommand(cmdCacheClear)
+}
+
+func runCacheClear(cmd *cobra.Command, args []string) error {
+	dir, err := ypkg.CacheDir()
+	if err != nil {
+		return fmt.Errorf("Failed to find cache directory: %w", err)
+	}
+
+	if err = ypkg.ClearCache(); err != nil {
+		return fmt.Errorf("Failed to clear cache at %s: %w", dir, err)
+	}
+	waterlog.Goodf("Cleared cache at %s\n", dir)
+	return nil
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	changedBase string
+	changedJSON bool
+
+	cmdChangedClosure = &cobra.Command{
+		Use:   "changed-closure [src:path]",
+		Short: "Print the order to rebuild the recipes changed since a git revision in",
+		Long: `Print the source recipes whose files changed since the git revision given by
+--base, along with every recipe that transitively build-depends on any of them,
+one per line, in an order where dependencies always come before their
+dependents. This is the list of packages to rebuild after the changes.
+
+For example: autobuild changed-closure src:../packages --base origin/main
+
+The changes are found in the same way as for subgraph --git-diff, and the order
+is the same as the one of bump-order. Pass --json to print both the changed
+recipes and the ordered rebuild list. If cycles prevent a full ordering, the
+remaining cycles are printed to stderr and the command exits with status 2.`,
+		RunE: runChangedClosure,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+// changedClosureReport is the output of changed-closure with --json.
+type changedClosureReport struct {
+	Base    string   `json:"base"`
+	Changed []string `json:"changed"`
+	Order   []string `json:"order"`
+}
+
+func init() {
+	cmdChangedClosure.Flags().StringVar(&changedBase, "base", "", "git revision to find the changed recipes since, e.g. origin/main")
+	cmdChangedClosure.MarkFlagRequired("base")
+	cmdChangedClosure.Flags().BoolVar(&changedJSON, "json", false, "print the changed recipes and the rebuild order as JSON")
+}
+
+func runChangedClosure(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	waterlog.SetOutput(os.Stderr)
+
+	root, isSrc := strings.CutPrefix(tpath, "src:")
+	if !isSrc {
+		return fmt.Errorf("changed-closure only supports source tpaths, got %s", tpath)
+	}
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	starts, err := gitChangedRecipes(state, gi, root, changedBase)
+	if err != nil {
+		return err
+	}
+	keep := gi.reachable(starts, -1, true)
+	affected := newGraphIndex(gi.data.Subgraph(func(node depgraph.GraphNode) bool { return keep[gi.ids[node.ID]] }))
+
+	order, ok := buildOrder(affected)
+	names := affected.names(order)
+	if changedJSON {
+		changed := gi.names(starts)
+		slices.Sort(changed)
+		out, err := json.MarshalIndent(changedClosureReport{Base: changedBase, Changed: changed, Order: names}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	}
+
+	if !ok {
+		waterlog.Errorf("%d package(s) could not be ordered due to cycles:\n", len(affected.data.Nodes)-len(order))
+		for cycleIdx, cycle := range findCycles(affected) {
+			waterlog.Errorf("Cycle %d: ", cycleIdx+1)
+			fmt.Fprintln(os.Stderr, strings.Join(cycle, " "))
+		}
+		return exitStatus(exitCycles)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkDepsIgnore string
+
+	cmdCheckDeps = &cobra.Command{
+		Use:   "check-deps [src:path] [src:previous-path]",
+		Short: "Report build dependencies that don't resolve to any package",
+		Long: `Report every build dependency that doesn't resolve to any package of the
+state, along with the source recipe that declared it.
+
+For example: autobuild check-deps src:../packages --ignore known-missing.txt
+
+Exits with a non-zero status if any unresolved dependency is found. Providers
+that are known to come from outside of the source tree can be listed, one per
+line, in the file passed to --ignore.
+
+When a previous state is given as well, only the build dependencies that
+resolved in the previous state but no longer do are reported, e.g. because a
+provider has been renamed or removed. Every such provider is printed with the
+package that used to provide it and the packages that depend on it:
+
+  autobuild check-deps src:../packages src:../packages-main`,
+		RunE: runCheckDeps,
+		Args: cobra.RangeArgs(1, 2),
+	}
+)
+
+// brokenDep is a provider that resolved in the previous state but not anymore.
+type brokenDep struct {
+	Provider   string
+	OldTarget  string
+	Dependents []string
+}
+
+// brokenDeps returns the build dependencies of `state` that don't resolve
+// anymore but did in `prev`, sorted by provider. `unresolved` are the
+// unresolved dependencies of `state`, as returned by unresolvedDeps.
+func brokenDeps(prev st.State, unresolved map[string][]string) (res []brokenDep) {
+	dependents := make(map[string][]string)
+	for src, deps := range unresolved {
+		for _, dep := range deps {
+			if _, found := prev.PvdToPkgIdx()[dep]; found {
+				dependents[dep] = append(dependents[dep], src)
+			}
+		}
+	}
+
+	for dep, srcs := range dependents {
+		slices.Sort(srcs)
+		res = append(res, brokenDep{
+			Provider:   dep,
+			OldTarget:  prev.Packages()[prev.PvdToPkgIdx()[dep]].Source,
+			Dependents: srcs,
+		})
+	}
+	slices.SortFunc(res, func(a, b brokenDep) int { return strings.Compare(a.Provider, b.Provider) })
+	return
+}
+
+func init() {
+	cmdCheckDeps.Flags().StringVar(&checkDepsIgnore, "ignore", "", "file listing providers that are allowed to be missing, one per line")
+}
+
+func runCheckDeps(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+
+	var allowed []string
+	if checkDepsIgnore != "" {
+		var err error
+		if allowed, err = utils.ReadPackageListFile(checkDepsIgnore); err != nil {
+			return fmt.Errorf("Failed to read ignore file %s: %w", checkDepsIgnore, err)
+		}
+	}
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	unresolved := unresolvedDeps(state)
+	for src, deps := range unresolved {
+		unresolved[src] = utils.Filter(deps, func(dep string) bool { return !slices.Contains(allowed, dep) })
+	}
+
+	if len(args) > 1 {
+		prev, err := st.LoadState(cmd.Context(), args[1], loadJobs)
+		if err != nil {
+			return fmt.Errorf("Failed to parse previous state: %w", err)
+		}
+		waterlog.Goodln("Successfully parsed previous state!")
+
+		broken := brokenDeps(prev, unresolved)
+		for _, dep := range broken {
+			waterlog.Errorf("%s (provided by %s before): ", dep.Provider, dep.OldTarget)
+			fmt.Println(strings.Join(dep.Dependents, " "))
+		}
+		if len(broken) > 0 {
+			return fmt.Errorf("Found %d build dependencies that don't resolve anymore", len(broken))
+		}
+		waterlog.Goodln("No build dependencies broke since the previous state!")
+		return nil
+	}
+
+	srcs := make([]string, 0, len(unresolved))
+	for src, deps := range unresolved {
+		if len(deps) > 0 {
+			srcs = append(srcs, src)
+		}
+	}
+	slices.Sort(srcs)
+
+	count := 0
+	for _, src := range srcs {
+		waterlog.Errorf("%s: ", src)
+		fmt.Println(strings.Join(unresolved[src], " "))
+		count += len(unresolved[src])
+	}
+
+	if count > 0 {
+		return fmt.Errorf("Found %d unresolved build dependencies in %d package(s)", count, len(srcs))
+	}
+	waterlog.Goodln("All build dependencies are resolved!")
+	return nil
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var cmdCheckDupes = &cobra.Command{
+	Use:   "check-dupes [src:path]",
+	Short: "Report source names that are declared by more than one recipe",
+	Long: `Report every source name that is declared by more than one recipe, along
+with the paths of those recipes.
+
+For example: autobuild check-dupes src:../packages
+
+Only the first of such recipes is considered by the graph commands, so this
+usually points to an accidentally copy-pasted recipe. Exits with a non-zero
+status if any duplicate is found.`,
+	RunE: runCheckDupes,
+	Args: cobra.ExactArgs(1),
+}
+
+func runCheckDupes(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	dupes := duplicateSources(state)
+	srcs := make([]string, 0, len(dupes))
+	for src := range dupes {
+		srcs = append(srcs, src)
+	}
+	slices.Sort(srcs)
+
+	for _, src := range srcs {
+		waterlog.Errorf("%s: ", src)
+		fmt.Println(strings.Join(dupes[src], " "))
+	}
+
+	if len(srcs) > 0 {
+		return fmt.Errorf("Found %d source name(s) declared by more than one recipe", len(srcs))
+	}
+	waterlog.Goodln("No duplicate sources found!")
+	return nil
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	maxFanout      int
+	fanoutWarnOnly bool
+
+	cmdCheckFanout = &cobra.Command{
+		Use:   "check-fanout [src:path]",
+		Short: "Report recipes with more build dependencies than allowed",
+		Long: `Report every source recipe whose build dependencies resolve to more than
+--max distinct packages, with the most dependencies first, to catch recipes
+that pulled in far more than expected.
+
+For example: autobuild check-fanout src:../packages --max 40
+
+Dependencies are counted as in the graph commands: several dependencies that
+resolve to the same recipe count once, and self-dependencies and unresolved
+ones are not counted. The command fails if any recipe exceeds the threshold,
+unless --warn-only is given.`,
+		RunE: runCheckFanout,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+func init() {
+	cmdCheckFanout.Flags().IntVar(&maxFanout, "max", 0, "maximum number of packages a recipe may build-depend on")
+	cmdCheckFanout.MarkFlagRequired("max")
+	cmdCheckFanout.Flags().BoolVar(&fanoutWarnOnly, "warn-only", false, "only report the recipes over the threshold without failing")
+}
+
+// overFanout returns the nodes that depend on more than `limit` packages, with
+// the most dependencies first and alphabetically on ties.
+func overFanout(graphData depgraph.GraphData, limit int) (res []depgraph.GraphNode) {
+	for _, node := range graphData.Nodes {
+		if node.OutDegree > limit {
+			res = append(res, node)
+		}
+	}
+	slices.SortFunc(res, func(a, b depgraph.GraphNode) int {
+		if c := cmp.Compare(b.OutDegree, a.OutDegree); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return
+}
+
+func runCheckFanout(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	over := overFanout(graphData, maxFanout)
+	for _, node := range over {
+		if fanoutWarnOnly {
+			waterlog.Warnf("%s: ", node.ID)
+		} else {
+			waterlog.Errorf("%s: ", node.ID)
+		}
+		fmt.Println(node.OutDegree)
+	}
+
+	if len(over) == 0 {
+		waterlog.Goodf("No recipe build-depends on more than %d packages!\n", maxFanout)
+	} else if fanoutWarnOnly {
+		waterlog.Warnf("Found %d recipe(s) that build-depend on more than %d packages\n", len(over), maxFanout)
+	} else {
+		return fmt.Errorf("Found %d recipe(s) that build-depend on more than %d packages", len(over), maxFanout)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkProvidersJSON bool
+
+	cmdCheckProviders = &cobra.Command{
+		Use:   "check-providers [src:path]",
+		Short: "Report unused providers and build dependencies without a provider",
+		Long: `Report the providers that no package depends on, which may be declared for
+nothing, and the build dependencies that don't match any provider, which are
+usually typos in the recipes.
+
+For example: autobuild check-providers src:../packages --json
+
+Exits with a non-zero status if any build dependency doesn't match a provider.`,
+		RunE: runCheckProviders,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+// providersReport is the output of check-providers with --json.
+type providersReport struct {
+	Unused     []string            `json:"unused"`
+	Unresolved map[string][]string `json:"unresolved"`
+}
+
+func init() {
+	cmdCheckProviders.Flags().BoolVar(&checkProvidersJSON, "json", false, "print the report as JSON")
+}
+
+func runCheckProviders(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	if checkProvidersJSON {
+		waterlog.SetOutput(os.Stderr)
+	}
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	report := providersReport{
+		Unused:     unusedProviders(state),
+		Unresolved: unresolvedDeps(state),
+	}
+
+	if checkProvidersJSON {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, pvd := range report.Unused {
+			waterlog.Infof("Unused: ")
+			fmt.Println(pvd)
+		}
+
+		srcs := make([]string, 0, len(report.Unresolved))
+		for src := range report.Unresolved {
+			srcs = append(srcs, src)
+		}
+		slices.Sort(srcs)
+		for _, src := range srcs {
+			waterlog.Errorf("Unresolved: %s: ", src)
+			fmt.Println(strings.Join(report.Unresolved[src], " "))
+		}
+	}
+
+	if len(report.Unresolved) > 0 {
+		return fmt.Errorf("Found build dependencies without a provider in %d package(s)", len(report.Unresolved))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var cmdCheckSelfDeps = &cobra.Command{
+	Use:   "check-selfdeps [src:path]",
+	Short: "Report recipes that build-depend on themselves",
+	Long: `Report every source recipe with build dependencies that resolve back to the
+recipe itself, along with those dependencies.
+
+For example: autobuild check-selfdeps src:../packages
+
+Such dependencies never show up as edges in the graph commands. They are
+usually harmless, e.g. when bootstrapping a compiler, but occasionally point to
+a recipe bug, so they are listed for review without failing.`,
+	RunE: runCheckSelfDeps,
+	Args: cobra.ExactArgs(1),
+}
+
+func runCheckSelfDeps(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	self := selfDeps(state)
+	srcs := make([]string, 0, len(self))
+	for src := range self {
+		srcs = append(srcs, src)
+	}
+	slices.Sort(srcs)
+
+	for _, src := range srcs {
+		waterlog.Warnf("%s: ", src)
+		fmt.Println(strings.Join(self[src], " "))
+	}
+
+	if len(srcs) > 0 {
+		waterlog.Infof("Found %d recipe(s) that build-depend on themselves\n", len(srcs))
+	} else {
+		waterlog.Goodln("No self-dependencies found!")
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	closureWithSelf bool
+	closureCount    bool
+
+	cmdClosure = &cobra.Command{
+		Use:   "closure [src:path] [package...]",
+		Short: "List the transitive build dependencies of packages",
+		Long: `List every source recipe that has to be built before the given ones, i.e.
+the union of their transitive build dependencies, one per line.
+
+For example: autobuild closure src:../packages rocblas hipblas
+
+Packages can be given as shell-style globs such as "python-*", or as regular
+expressions with --regex. The given packages themselves are only listed if
+another given package depends on them, or if --with-self is passed.
+
+Pass "-" as a package to read more packages from stdin, one per line, which
+avoids running into argument limits with long lists.`,
+		RunE: runClosure,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errors.New("expects a source path and at least one package")
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	cmdClosure.Flags().BoolVar(&closureWithSelf, "with-self", false, "include the given packages in the list")
+	cmdClosure.Flags().BoolVar(&closureCount, "count", false, "only print the number of packages")
+	selectFlagsInit(cmdClosure)
+}
+
+// closure returns the names of the packages that `starts` transitively depend
+// on in at most `depth` hops, sorted by name. When `reverse` is true, the
+// packages that transitively depend on `starts` are returned instead. The
+// vertices in `starts` are only included if `withSelf` is true or if they are
+// reached from another one of them.
+func closure(gi *graphIndex, starts []int, depth int, reverse bool, withSelf bool) []string {
+	keep := make(map[int]bool)
+	for _, start := range starts {
+		for v := range gi.reachable([]int{start}, depth, reverse) {
+			if v != start || withSelf {
+				keep[v] = true
+			}
+		}
+	}
+
+	vs := make([]int, 0, len(keep))
+	for v := range keep {
+		vs = append(vs, v)
+	}
+	res := gi.names(vs)
+	sort.Strings(res)
+	return res
+}
+
+func runClosure(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	waterlog.SetOutput(os.Stderr)
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	starts, err := selectPackages(gi, args[1:])
+	if err != nil {
+		return err
+	}
+	names := closure(gi, starts, -1, false, closureWithSelf)
+	if closureCount {
+		fmt.Println(len(names))
+		return nil
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
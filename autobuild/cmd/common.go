@@ -4,13 +4,23 @@
 
 package cmd
 
-import "github.com/spf13/cobra"
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+)
 
 var (
-	quiet       bool
-	verbose     bool
-	sourcesPath string
-	indexPath   string
+	quiet        bool
+	verbose      bool
+	noCache      bool
+	loadJobs     int
+	timeout      time.Duration
+	profilePath  string
+	noIgnore     bool
+	basePrefixes []string
+	sourcesPath  string
+	indexPath    string
 )
 
 func pathsInit(cmd *cobra.Command) {
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+// noComponent is the component of the packages that don't declare any.
+const noComponent = "(none)"
+
+var (
+	componentsJSON bool
+
+	cmdComponents = &cobra.Command{
+		Use:   "components [src:path]",
+		Short: "Summarize the packages and build dependencies of every component",
+		Long: `Print, for every component, the number of source recipes in it and the number
+of build dependencies within the component, from it to other components and
+from other components to it.
+
+For example: autobuild components src:../packages
+
+Split packages whose subpackages are in different components are counted in
+the component of the main package, i.e. the first component listed in their
+package.yml.`,
+		RunE: runComponents,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+// componentStat summarizes the packages of a component and the dependencies
+// between them and the other components.
+type componentStat struct {
+	Component string `json:"component"`
+	Packages  int    `json:"packages"`
+	Internal  int    `json:"internal"`
+	Outgoing  int    `json:"outgoing"`
+	Incoming  int    `json:"incoming"`
+}
+
+func init() {
+	cmdComponents.Flags().BoolVar(&componentsJSON, "json", false, "print the summary as JSON")
+}
+
+// mainComponent returns the component of the main package of the node.
+func mainComponent(node depgraph.GraphNode) string {
+	if node.Component == "" {
+		return noComponent
+	}
+	component, _, _ := strings.Cut(node.Component, ",")
+	return component
+}
+
+// componentStats returns the summary of every component, sorted by name.
+func componentStats(graphData depgraph.GraphData) []componentStat {
+	stats := make(map[string]*componentStat)
+	componentOf := make(map[string]string, len(graphData.Nodes))
+	for _, node := range graphData.Nodes {
+		component := mainComponent(node)
+		componentOf[node.ID] = component
+		if stats[component] == nil {
+			stats[component] = &componentStat{Component: component}
+		}
+		stats[component].Packages++
+	}
+
+	for _, edge := range graphData.Edges {
+		src, target := componentOf[edge.Source], componentOf[edge.Target]
+		if src == target {
+			stats[src].Internal++
+		} else {
+			stats[src].Outgoing++
+			stats[target].Incoming++
+		}
+	}
+
+	res := make([]componentStat, 0, len(stats))
+	for _, stat := range stats {
+		res = append(res, *stat)
+	}
+	slices.SortFunc(res, func(a, b componentStat) int { return strings.Compare(a.Component, b.Component) })
+	return res
+}
+
+func runComponents(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	waterlog.SetOutput(os.Stderr)
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	stats := componentStats(graphData)
+
+	if componentsJSON {
+		out, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Component\tPackages\tInternal\tOutgoing\tIncoming")
+	for _, stat := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", stat.Component, stat.Packages, stat.Internal, stat.Outgoing, stat.Incoming)
+	}
+	w.Flush()
+	return nil
+}
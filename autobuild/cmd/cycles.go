@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+	"github.com/yourbasic/graph"
+)
+
+var (
+	cyclesJSON bool
+
+	cmdCycles = &cobra.Command{
+		Use:   "cycles [src:path]",
+		Short: "Report dependency cycles between source recipes",
+		Long: `Report every cycle in the build dependency graph between source recipes.
+
+For example: autobuild cycles src:../packages
+
+Every strongly connected component with more than one recipe is reported as a
+cycle, and so is every recipe that build-depends on itself. Exits with a
+non-zero status if any cycle is found, so it can be used to gate CI.
+
+With --json, the cycles are printed as JSON along with the edges between their
+members and the build dependencies behind every edge, which are the candidates
+for breaking the cycle.`,
+		RunE: runCycles,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+// cyclesReport is the output of cycles with --json.
+type cyclesReport struct {
+	Cycles   []cycleReport       `json:"cycles"`
+	SelfDeps map[string][]string `json:"selfDeps"`
+}
+
+type cycleReport struct {
+	Packages []string          `json:"packages"`
+	Edges    []cycleEdgeReport `json:"edges"`
+}
+
+// cycleEdgeReport is an edge between two members of a cycle, along with the
+// build dependencies of the source that resolve to the target.
+type cycleEdgeReport struct {
+	Source    string   `json:"source"`
+	Target    string   `json:"target"`
+	Providers []string `json:"providers"`
+}
+
+func init() {
+	cmdCycles.Flags().BoolVar(&cyclesJSON, "json", false, "print the cycles and the edges within them as JSON")
+}
+
+// findCycles returns the strongly connected components of the graph that
+// contain more than one node. Both the members of each cycle and the cycles
+// themselves are sorted so that the output is deterministic.
+func findCycles(gi *graphIndex) (cycles [][]string) {
+	for _, scc := range graph.StrongComponents(gi.g) {
+		if len(scc) <= 1 {
+			continue
+		}
+		cycle := gi.names(scc)
+		slices.Sort(cycle)
+		cycles = append(cycles, cycle)
+	}
+	slices.SortFunc(cycles, func(a, b []string) int { return strings.Compare(a[0], b[0]) })
+	return
+}
+
+// reportCycles lists the edges of `gi` within every cycle.
+func reportCycles(state st.State, gi *graphIndex, cycles [][]string) []cycleReport {
+	res := make([]cycleReport, len(cycles))
+	cycleOf := make(map[string]int)
+	for cycleIdx, cycle := range cycles {
+		res[cycleIdx] = cycleReport{Packages: cycle, Edges: make([]cycleEdgeReport, 0)}
+		for _, name := range cycle {
+			cycleOf[name] = cycleIdx
+		}
+	}
+
+	for _, edge := range gi.data.Edges {
+		cycleIdx, srcFound := cycleOf[edge.Source]
+		targetIdx, targetFound := cycleOf[edge.Target]
+		if !srcFound || !targetFound || cycleIdx != targetIdx {
+			continue
+		}
+		res[cycleIdx].Edges = append(res[cycleIdx].Edges, cycleEdgeReport{
+			Source:    edge.Source,
+			Target:    edge.Target,
+			Providers: edgeProviders(state, edge.Source, edge.Target),
+		})
+	}
+	return res
+}
+
+func runCycles(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	if cyclesJSON {
+		waterlog.SetOutput(os.Stderr)
+	}
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	cycles := findCycles(gi)
+	self := selfDeps(state)
+
+	if cyclesJSON {
+		out, err := json.MarshalIndent(cyclesReport{Cycles: reportCycles(state, gi, cycles), SelfDeps: self}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+	} else {
+		for cycleIdx, cycle := range cycles {
+			waterlog.Errorf("Cycle %d: ", cycleIdx+1)
+			fmt.Println(strings.Join(cycle, " "))
+		}
+
+		srcs := make([]string, 0, len(self))
+		for src := range self {
+			srcs = append(srcs, src)
+		}
+		slices.Sort(srcs)
+		for _, src := range srcs {
+			waterlog.Errorf("Self-dependency: %s (via %s)\n", src, strings.Join(self[src], ", "))
+		}
+	}
+
+	if len(cycles) > 0 || len(self) > 0 {
+		return fmt.Errorf("Found %d cycle(s) and %d self-dependency(ies)", len(cycles), len(self))
+	}
+	waterlog.Goodln("No cycles found!")
+	return nil
+}
@@ -5,6 +5,11 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
 	"github.com/DataDrake/waterlog"
 	"github.com/GZGavinZhao/autobuild/state"
 	"github.com/spf13/cobra"
@@ -12,53 +17,144 @@ import (
 
 var (
 	strictDiff bool
+	jsonDiff   bool
 
 	cmdDiff = &cobra.Command{
 		Use:   "diff <[src|bin|repo]:path-to-old> <[src|bin|repo]:path-to-new>",
 		Short: "Diff the packages between binary indices or sources or a mix of them",
-		Run:   runDiff,
-		Args:  cobra.ExactArgs(2),
+		Long: `Diff the packages between binary indices or sources or a mix of them.
+
+Reports the source recipes that were added, removed, or changed their version
+or release number. When both states are source trees, it also reports the
+recipes whose build dependencies changed, along with the specific dependencies
+that were added or removed.`,
+		RunE: runDiff,
+		Args: cobra.ExactArgs(2),
 	}
 )
 
+// versionChange is a source recipe whose version or release number differs
+// between the two states.
+type versionChange struct {
+	Source     string `json:"source"`
+	OldVersion string `json:"oldVersion"`
+	OldRelease int    `json:"oldRelease"`
+	Version    string `json:"version"`
+	Release    int    `json:"release"`
+}
+
+type diffReport struct {
+	Added       []string         `json:"added,omitempty"`
+	Removed     []string         `json:"removed,omitempty"`
+	Updated     []versionChange  `json:"updated,omitempty"`
+	Outdated    []versionChange  `json:"outdated,omitempty"`
+	SameRelease []versionChange  `json:"sameRelease,omitempty"`
+	DepsChanged []state.DepsDiff `json:"depsChanged,omitempty"`
+}
+
 func init() {
 	cmdDiff.Flags().BoolVarP(&strictDiff, "strict", "s", false, "show and warn suspicious changes such as outdated packages or unbumped relnos")
+	cmdDiff.Flags().BoolVar(&jsonDiff, "json", false, "output the diff as JSON")
+}
+
+func diffStates(oldState, newState state.State) (report diffReport) {
+	report.Added = state.Added(&oldState, &newState)
+	report.Removed = state.Removed(&oldState, &newState)
+
+	for _, diff := range state.Changed(&oldState, &newState) {
+		if diff.OldRelNum == 0 {
+			// Already reported as added
+			continue
+		}
+
+		change := versionChange{
+			Source:     newState.Packages()[diff.Idx].Source,
+			OldVersion: diff.OldVer,
+			OldRelease: diff.OldRelNum,
+			Version:    diff.Ver,
+			Release:    diff.RelNum,
+		}
+		if diff.RelNum > diff.OldRelNum {
+			report.Updated = append(report.Updated, change)
+		} else if diff.RelNum < diff.OldRelNum {
+			report.Outdated = append(report.Outdated, change)
+		} else if diff.Ver != diff.OldVer {
+			report.SameRelease = append(report.SameRelease, change)
+		}
+	}
+	for _, changes := range [][]versionChange{report.Updated, report.Outdated, report.SameRelease} {
+		slices.SortFunc(changes, func(a, b versionChange) int { return strings.Compare(a.Source, b.Source) })
+	}
+
+	// Binary states don't carry build dependencies, so comparing them against
+	// a source state would report every dependency as changed.
+	_, oldIsSrc := oldState.(*state.SourceState)
+	_, newIsSrc := newState.(*state.SourceState)
+	if oldIsSrc && newIsSrc {
+		report.DepsChanged = state.DepsChanged(&oldState, &newState)
+	}
+
+	return
 }
 
-func runDiff(cmd *cobra.Command, args []string) {
+func runDiff(cmd *cobra.Command, args []string) error {
 	oldTPath := args[0]
 	newTPath := args[1]
 
 	var oldState, newState state.State
 
-	oldState, err := state.LoadState(oldTPath)
+	oldState, err := state.LoadState(cmd.Context(), oldTPath, loadJobs)
 	if err != nil {
-		waterlog.Fatalf("Failed to load old state %s: %s\n", oldTPath, err)
+		return fmt.Errorf("Failed to load old state %s: %w", oldTPath, err)
 	}
 	waterlog.Goodln("Successfully parsed old state!")
 
-	newState, err = state.LoadState(newTPath)
+	newState, err = state.LoadState(cmd.Context(), newTPath, loadJobs)
 	if err != nil {
-		waterlog.Fatalf("Failed to load new state %s: %s\n", newTPath, err)
+		return fmt.Errorf("Failed to load new state %s: %w", newTPath, err)
 	}
 	waterlog.Goodln("Successfully parsed new state!")
 
 	waterlog.Infoln("Diffing...")
-	for _, diff := range state.Changed(&oldState, &newState) {
-		name := newState.Packages()[diff.Idx].Source
+	report := diffStates(oldState, newState)
 
-		if diff.OldRelNum == 0 {
-			waterlog.Infof("New: %s: %s-%d\n", name, diff.Ver, diff.RelNum)
-		} else if diff.RelNum > diff.OldRelNum {
-			waterlog.Infof("Rebuild/Change: %s: %s-%d -> %s-%d\n", name, diff.OldVer, diff.OldRelNum, diff.Ver, diff.RelNum)
-		} else if diff.RelNum < diff.OldRelNum {
-			if strictDiff {
-				waterlog.Warnf("Outdated: %s: %s-%d <- %s-%d\n", name, diff.OldVer, diff.OldRelNum, diff.Ver, diff.RelNum)
-			}
-		} else if diff.Ver != diff.OldVer {
-			if strictDiff {
-				waterlog.Warnf("Different version but same relno: %s: %s-%d -> %s-%d\n", name, diff.OldVer, diff.OldRelNum, diff.Ver, diff.RelNum)
-			}
+	if jsonDiff {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	for _, src := range report.Added {
+		pkg := newState.Packages()[newState.SrcToPkgIds()[src][0]]
+		waterlog.Infof("New: %s: %s-%d\n", src, pkg.Version, pkg.Release)
+	}
+	for _, src := range report.Removed {
+		pkg := oldState.Packages()[oldState.SrcToPkgIds()[src][0]]
+		waterlog.Infof("Removed: %s: %s-%d\n", src, pkg.Version, pkg.Release)
+	}
+	for _, c := range report.Updated {
+		waterlog.Infof("Rebuild/Change: %s: %s-%d -> %s-%d\n", c.Source, c.OldVersion, c.OldRelease, c.Version, c.Release)
+	}
+	if strictDiff {
+		for _, c := range report.Outdated {
+			waterlog.Warnf("Outdated: %s: %s-%d <- %s-%d\n", c.Source, c.OldVersion, c.OldRelease, c.Version, c.Release)
+		}
+		for _, c := range report.SameRelease {
+			waterlog.Warnf("Different version but same relno: %s: %s-%d -> %s-%d\n", c.Source, c.OldVersion, c.OldRelease, c.Version, c.Release)
+		}
+	}
+	for _, d := range report.DepsChanged {
+		var changes []string
+		for _, dep := range d.Added {
+			changes = append(changes, "+"+dep)
+		}
+		for _, dep := range d.Removed {
+			changes = append(changes, "-"+dep)
 		}
+		waterlog.Infof("Build deps changed: %s: %s\n", d.Source, strings.Join(changes, " "))
 	}
+	return nil
 }
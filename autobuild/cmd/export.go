@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat string
+	splitDir     string
+
+	cmdExport = &cobra.Command{
+		Use:   "export [src:path...] [output]",
+		Short: "Export dependency graph, inferring the format from the output file",
+		Long: `Export the package dependency graph in the format given by the extension of
+the output file:
+
+  .json        JSON for the depgraph web visualization (see export-json)
+  .dot, .gv    Graphviz DOT (see export-dot)
+  .graphml     GraphML (see export-graphml)
+  .gexf        GEXF for Gephi (see export-gexf)
+  .cyjs        Cytoscape.js elements JSON (see export-cytoscape)
+  .yaml, .yml  YAML, with the same structure and keys as the JSON export
+  .mmd         Mermaid flowchart, e.g. to embed in Markdown
+  .jsonl       JSON Lines, one object per package and dependency
+
+For example: autobuild export src:../packages2 deps.dot
+
+Multiple source paths can be given to merge them into a single graph, in which
+case recipes from later paths override the ones with the same source name from
+earlier paths.
+
+Use --format to override the detected format, which is required when writing
+to stdout with "-". --format adjacency, which has no extension of its own,
+writes a JSON object mapping every package to the packages it depends on, along
+with a map from every package to its metadata.
+
+The JSON Lines export starts with a {"type":"graph"} object holding the schema
+version, followed by one {"type":"node"} object per package and one
+{"type":"edge"} object per dependency, with the same fields as in the JSON
+export. Every dependency is written as soon as it is resolved, without ever
+holding all of them in memory, and the output is flushed as it goes, so that
+consumers can start reading before the export finishes. The filters, e.g.
+--exclude-base or --max-nodes, as well as --direction buildflow, --focus,
+--highlight and --follow-runtime-of-build-deps need the whole graph, so it is
+built in full before it is written when any of them is used.
+
+--format graphson writes the GraphSON 3.0 adjacency list format that TinkerPop
+reads, e.g. with g.io("deps.json").read() in Gremlin: one "package" vertex per
+line with "name", "version", "release", "component" and "isBase" properties,
+and "depends" edges with "kind" and "weight" properties. Vertices and edges get
+integer IDs in the order of the graph.
+
+With --split-by-component DIR, no output file is given. Instead, the packages
+of every component are written as JSON to DIR/<component>/graph.json, along
+with their dependencies and dependents from other components, which are marked
+as "external". Split packages are part of every one of their components, and
+packages without a component are only ever written as external ones. DIR
+gets an index.json listing every component, the path of its graph relative to
+DIR and its number of packages, e.g. for a site that drills down into them.`,
+		RunE: runExport,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if splitDir != "" {
+				return cobra.MinimumNArgs(1)(cmd, args)
+			}
+			return exportArgs(cmd, args)
+		},
+	}
+)
+
+// GraphWriter encodes a dependency graph in a specific file format.
+type GraphWriter interface {
+	WriteGraph(graphData depgraph.GraphData) ([]byte, error)
+}
+
+// graphWriters maps the names accepted by --format to their writer.
+var graphWriters = map[string]func() GraphWriter{
+	"json":      func() GraphWriter { return jsonWriter{compact: compactJSON} },
+	"dot":       func() GraphWriter { return dotWriter{rankdir: rankdir, clusterBy: clusterBy} },
+	"graphml":   func() GraphWriter { return graphMLWriter{} },
+	"gexf":      func() GraphWriter { return gexfWriter{} },
+	"cytoscape": func() GraphWriter { return cytoscapeWriter{} },
+	"yaml":      func() GraphWriter { return yamlWriter{} },
+	"adjacency": func() GraphWriter { return adjacencyWriter{compact: compactJSON} },
+	"mermaid":   func() GraphWriter { return mermaidWriter{} },
+	"jsonl":     func() GraphWriter { return jsonlWriter{} },
+	"graphson":  func() GraphWriter { return graphSONWriter{} },
+}
+
+// formatExtensions maps output file extensions to the format they imply.
+var formatExtensions = map[string]string{
+	".json":    "json",
+	".dot":     "dot",
+	".gv":      "dot",
+	".graphml": "graphml",
+	".gexf":    "gexf",
+	".cyjs":    "cytoscape",
+	".yaml":    "yaml",
+	".yml":     "yaml",
+	".mmd":     "mermaid",
+	".jsonl":   "jsonl",
+}
+
+func init() {
+	exportFlagsInit(cmdExport)
+	compactFlagInit(cmdExport)
+	cmdExport.Flags().StringVarP(&exportFormat, "format", "f", "", "output format, one of json, dot, graphml, gexf, cytoscape, yaml, adjacency, mermaid, jsonl or graphson (default: inferred from the output extension)")
+	cmdExport.Flags().StringVar(&rankdir, "rankdir", "LR", "direction of the graph layout for DOT, one of TB, LR, BT or RL")
+	clusterFlagInit(cmdExport)
+	cmdExport.Flags().StringVar(&splitDir, "split-by-component", "", "write one JSON graph per component to `DIR`, instead of a single output file")
+	modeFlagInit(cmdExport)
+}
+
+// exportFormatNames returns the sorted names accepted by --format.
+func exportFormatNames() []string {
+	names := make([]string, 0, len(graphWriters))
+	for name := range graphWriters {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// detectFormat returns the format to export to `outputPath`, preferring
+// `format` if it is set.
+func detectFormat(format string, outputPath string) (string, error) {
+	if format != "" {
+		if _, ok := graphWriters[format]; !ok {
+			return "", fmt.Errorf("Unknown format %s, must be one of %s", format, strings.Join(exportFormatNames(), ", "))
+		}
+		return format, nil
+	}
+
+	if outputPath == stdoutPath {
+		return "", errors.New("Unable to infer the format when writing to stdout, please pass --format")
+	}
+	ext := strings.ToLower(filepath.Ext(outputPath))
+	format, ok := formatExtensions[ext]
+	if !ok {
+		return "", fmt.Errorf("Unable to infer the format from extension \"%s\" of %s, please pass --format", ext, outputPath)
+	}
+	return format, nil
+}
+
+// exportArgs validates the arguments of the export commands: one or more
+// tpaths followed by the output path.
+func exportArgs(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return errors.New("expects at least two args: source path(s) and output file path")
+	}
+	return nil
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	if splitDir != "" {
+		if exportFormat != "" && exportFormat != "json" {
+			return errors.New("--split-by-component only supports the json format")
+		}
+		return runSplitExport(cmd.Context(), args, splitDir)
+	}
+	redirectLogs(args[len(args)-1])
+
+	format, err := detectFormat(exportFormat, args[len(args)-1])
+	if err != nil {
+		return err
+	}
+	if format == "dot" {
+		if err := checkDOTFlags(); err != nil {
+			return err
+		}
+	}
+
+	return runExportWith(cmd.Context(), args, graphWriters[format]())
+}
+
+// runExportWith exports the graph of the states at all but the last of `args`
+// to the output path given by the last one with `writer`.
+func runExportWith(ctx context.Context, args []string, writer GraphWriter) error {
+	tpaths := args[:len(args)-1]
+	outputPath := args[len(args)-1]
+	redirectLogs(outputPath)
+
+	if streamer, ok := writer.(GraphStreamer); ok {
+		return streamExport(ctx, tpaths, outputPath, streamer)
+	}
+
+	graphData, err := exportGraph(ctx, tpaths)
+	if err != nil {
+		return err
+	}
+	defer utils.TrackPhase("encoding and writing the graph")()
+	data, err := writer.WriteGraph(graphData)
+	if err != nil {
+		return err
+	}
+	if err = writeOutput(outputPath, data); err != nil {
+		return err
+	}
+
+	reportExport(graphData, outputPath, len(data))
+	return nil
+}
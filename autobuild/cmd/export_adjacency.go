@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/GZGavinZhao/autobuild/depgraph"
+)
+
+// adjacencyGraph maps every package to the packages it depends on, with the
+// metadata of the packages in a separate map.
+type adjacencyGraph struct {
+	SchemaVersion int                      `json:"schemaVersion"`
+	Nodes         map[string]adjacencyNode `json:"nodes"`
+	Adjacency     map[string][]string      `json:"adjacency"`
+}
+
+type adjacencyNode struct {
+	IsBase    bool   `json:"isBase,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Release   int    `json:"release,omitempty"`
+	Component string `json:"component,omitempty"`
+}
+
+// adjacencyWriter encodes the graph as an adjacency map. Edges of different
+// kinds between the same packages are merged.
+type adjacencyWriter struct {
+	compact bool
+}
+
+func (w adjacencyWriter) WriteGraph(graphData depgraph.GraphData) (data []byte, err error) {
+	res := adjacencyGraph{
+		SchemaVersion: graphData.SchemaVersion,
+		Nodes:         make(map[string]adjacencyNode, len(graphData.Nodes)),
+		Adjacency:     make(map[string][]string, len(graphData.Nodes)),
+	}
+	for _, node := range graphData.Nodes {
+		res.Nodes[node.ID] = adjacencyNode{
+			IsBase:    node.IsBase,
+			Version:   node.Version,
+			Release:   node.Release,
+			Component: node.Component,
+		}
+		res.Adjacency[node.ID] = make([]string, 0)
+	}
+	// The edges are sorted by source and target already
+	for _, edge := range graphData.Edges {
+		if !slices.Contains(res.Adjacency[edge.Source], edge.Target) {
+			res.Adjacency[edge.Source] = append(res.Adjacency[edge.Source], edge.Target)
+		}
+	}
+
+	if w.compact {
+		data, err = json.Marshal(res)
+	} else {
+		data, err = json.MarshalIndent(res, "", "  ")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal JSON: %w", err)
+	}
+	return data, nil
+}
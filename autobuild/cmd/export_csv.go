@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	"github.com/spf13/cobra"
+)
+
+var cmdExportCSV = &cobra.Command{
+	Use:   "export-csv [src:path...] [output]",
+	Short: "Export dependency graph as CSV edge and node lists",
+	Long: `Export the package dependency graph as CSV files for spreadsheets and pandas.
+
+For example: autobuild export-csv src:../packages2 deps.csv
+
+The output file lists one edge per row with the columns source, target, kind
+and weight, after a header row. The nodes are written next to it, to
+deps.nodes.csv in the example above, with the columns id, isBase, component
+and version. When writing the edges to stdout with "-", the nodes are not
+written. The same flags as export-json are supported to select the nodes and
+edges.`,
+	RunE: runExportCSV,
+	Args: exportArgs,
+}
+
+func init() {
+	exportFlagsInit(cmdExportCSV)
+	modeFlagInit(cmdExportCSV)
+}
+
+// csvWriter encodes the edges of the graph as CSV.
+type csvWriter struct{}
+
+func (csvWriter) WriteGraph(graphData depgraph.GraphData) ([]byte, error) {
+	records := [][]string{{"source", "target", "kind", "weight"}}
+	for _, edge := range graphData.Edges {
+		records = append(records, []string{edge.Source, edge.Target, edge.Kind, strconv.Itoa(edge.Weight)})
+	}
+	return encodeCSV(records)
+}
+
+// writeNodesCSV encodes the nodes of the graph as CSV.
+func writeNodesCSV(graphData depgraph.GraphData) ([]byte, error) {
+	records := [][]string{{"id", "isBase", "component", "version"}}
+	for _, node := range graphData.Nodes {
+		records = append(records, []string{node.ID, strconv.FormatBool(node.IsBase), node.Component, node.Version})
+	}
+	return encodeCSV(records)
+}
+
+// encodeCSV writes the records with a csv.Writer, which takes care of quoting
+// fields that contain commas or quotes.
+func encodeCSV(records [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := csv.NewWriter(&buf).WriteAll(records); err != nil {
+		return nil, fmt.Errorf("Failed to encode CSV: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// nodesCSVPath returns the path of the nodes file that goes with the edges
+// written to `outputPath`.
+func nodesCSVPath(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".nodes.csv"
+}
+
+func runExportCSV(cmd *cobra.Command, args []string) error {
+	tpaths := args[:len(args)-1]
+	outputPath := args[len(args)-1]
+	redirectLogs(outputPath)
+
+	graphData, err := exportGraph(cmd.Context(), tpaths)
+	if err != nil {
+		return err
+	}
+	data, err := csvWriter{}.WriteGraph(graphData)
+	if err != nil {
+		return err
+	}
+	if err = writeOutput(outputPath, data); err != nil {
+		return err
+	}
+	size := len(data)
+
+	if outputPath != stdoutPath {
+		nodesPath := nodesCSVPath(outputPath)
+		if data, err = writeNodesCSV(graphData); err != nil {
+			return err
+		}
+		if err = writeOutput(nodesPath, data); err != nil {
+			return err
+		}
+		waterlog.Goodf("Successfully exported nodes to %s\n", nodesPath)
+	}
+
+	reportExport(graphData, outputPath, size)
+	return nil
+}
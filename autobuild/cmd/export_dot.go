@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rankdir   string
+	clusterBy string
+
+	cmdExportDOT = &cobra.Command{
+		Use:   "export-dot [src:path...] [output]",
+		Short: "Export dependency graph in the Graphviz DOT format",
+		Long: `Export the package dependency graph in the Graphviz DOT format.
+
+For example: autobuild export-dot src:../packages2 deps.dot
+
+The nodes and edges are the same as the ones produced by export-json, and the
+same flags are supported to select them. Base packages are filled with a
+distinct color. The output can be rendered with Graphviz, e.g.
+"dot -Tpdf deps.dot -o deps.pdf".
+
+With --cluster-by component, the packages of every component are drawn in a
+box labelled with the component, and base packages in a box of their own, which
+makes large graphs much easier to read.`,
+		RunE: runExportDOT,
+		Args: exportArgs,
+	}
+)
+
+const (
+	dotBaseFillColor = "lightblue"
+	// clusterComponent is the value of --cluster-by that groups packages by
+	// component.
+	clusterComponent = "component"
+	// dotBaseCluster is the label of the cluster of base packages.
+	dotBaseCluster = "base"
+)
+
+func init() {
+	exportFlagsInit(cmdExportDOT)
+	cmdExportDOT.Flags().StringVar(&rankdir, "rankdir", "LR", "direction of the graph layout, one of TB, LR, BT or RL")
+	clusterFlagInit(cmdExportDOT)
+	modeFlagInit(cmdExportDOT)
+}
+
+// clusterFlagInit registers the --cluster-by flag of the commands that write
+// the graph as DOT.
+func clusterFlagInit(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&clusterBy, "cluster-by", "", "draw the packages of every `component` in a box of their own, for DOT")
+}
+
+// dotID quotes `id` so that it is always a valid DOT identifier, even when it
+// contains characters such as '+' or '.'.
+func dotID(id string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(id) + `"`
+}
+
+// dotClusterName turns `label` into the name of a DOT cluster, made of
+// letters, digits and underscores only, that isn't in `used` yet. The name is
+// added to `used`.
+func dotClusterName(label string, used map[string]bool) string {
+	base := "cluster_" + strings.Map(func(r rune) rune {
+		if r < 128 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return '_'
+	}, label)
+
+	name := base
+	for idx := 2; used[name]; idx++ {
+		name = fmt.Sprintf("%s_%d", base, idx)
+	}
+	used[name] = true
+	return name
+}
+
+// dotWriter encodes the graph in the Graphviz DOT format, laid out in the
+// `rankdir` direction. Nodes are grouped into clusters by component if
+// `clusterBy` is clusterComponent.
+type dotWriter struct {
+	rankdir   string
+	clusterBy string
+}
+
+func (w dotWriter) WriteGraph(graphData depgraph.GraphData) ([]byte, error) {
+	return writeDOT(graphData, w.rankdir, w.clusterBy), nil
+}
+
+// writeDOTNode writes the statement of `node`, indented by `indent`.
+func writeDOTNode(sb *strings.Builder, node depgraph.GraphNode, indent string) {
+	if node.IsBase {
+		fmt.Fprintf(sb, "%s%s [style=filled, fillcolor=%s];\n", indent, dotID(node.ID), dotBaseFillColor)
+	} else {
+		fmt.Fprintf(sb, "%s%s;\n", indent, dotID(node.ID))
+	}
+}
+
+func writeDOT(graphData depgraph.GraphData, rankdir string, clusterBy string) []byte {
+	var sb strings.Builder
+
+	sb.WriteString("digraph deps {\n")
+	fmt.Fprintf(&sb, "\trankdir=%s;\n", rankdir)
+	if clusterBy != clusterComponent {
+		for _, node := range graphData.Nodes {
+			writeDOTNode(&sb, node, "\t")
+		}
+	} else {
+		// Base packages form a cluster of their own, and packages without a
+		// component are left out of every cluster
+		var labels []string
+		clusters := make(map[string][]depgraph.GraphNode)
+		for _, node := range graphData.Nodes {
+			label := node.Component
+			if node.IsBase {
+				label = dotBaseCluster
+			}
+			if label == "" {
+				writeDOTNode(&sb, node, "\t")
+				continue
+			}
+			if _, found := clusters[label]; !found {
+				labels = append(labels, label)
+			}
+			clusters[label] = append(clusters[label], node)
+		}
+
+		slices.Sort(labels)
+		used := make(map[string]bool, len(labels))
+		for _, label := range labels {
+			fmt.Fprintf(&sb, "\tsubgraph %s {\n", dotClusterName(label, used))
+			fmt.Fprintf(&sb, "\t\tlabel=%s;\n", dotID(label))
+			for _, node := range clusters[label] {
+				writeDOTNode(&sb, node, "\t\t")
+			}
+			sb.WriteString("\t}\n")
+		}
+	}
+	for _, edge := range graphData.Edges {
+		fmt.Fprintf(&sb, "\t%s -> %s;\n", dotID(edge.Source), dotID(edge.Target))
+	}
+	sb.WriteString("}\n")
+
+	return []byte(sb.String())
+}
+
+// checkDOTFlags returns an error if the --rankdir flag is not a valid DOT
+// direction, or --cluster-by isn't supported. They are checked before loading
+// the state, which can take a while.
+func checkDOTFlags() error {
+	if !slices.Contains([]string{"TB", "LR", "BT", "RL"}, rankdir) {
+		return fmt.Errorf("Invalid rankdir %s, must be one of TB, LR, BT or RL", rankdir)
+	}
+	if clusterBy != "" && clusterBy != clusterComponent {
+		return fmt.Errorf("Invalid --cluster-by %s, must be %s", clusterBy, clusterComponent)
+	}
+	return nil
+}
+
+func runExportDOT(cmd *cobra.Command, args []string) error {
+	redirectLogs(args[len(args)-1])
+	if err := checkDOTFlags(); err != nil {
+		return err
+	}
+
+	return runExportWith(cmd.Context(), args, dotWriter{rankdir: rankdir, clusterBy: clusterBy})
+}
@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	"gopkg.in/yaml.v3"
+)
+
+// jsonLines checks that every line of `data` is a JSON object, and returns
+// them.
+func jsonLines(data []byte) (res []map[string]any, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		var line map[string]any
+		if err = json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, err
+		}
+		res = append(res, line)
+	}
+	return res, scanner.Err()
+}
+
+// jsonlDocument reassembles a JSON Lines export into the document of the JSON
+// export.
+func jsonlDocument(data []byte) ([]byte, error) {
+	lines, err := jsonLines(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || lines[0]["type"] != "graph" {
+		return nil, errors.New("the first line is not a graph object")
+	}
+	doc := map[string]any{"nodes": []any{}, "edges": []any{}}
+	for key, value := range lines[0] {
+		doc[key] = value
+	}
+	delete(doc, "type")
+	for _, line := range lines[1:] {
+		kind := line["type"]
+		delete(line, "type")
+		switch kind {
+		case "node":
+			doc["nodes"] = append(doc["nodes"].([]any), line)
+		case "edge":
+			doc["edges"] = append(doc["edges"].([]any), line)
+		default:
+			return nil, fmt.Errorf("unknown line of type %v", kind)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// yamlDocument converts a YAML export into the document of the JSON export.
+func yamlDocument(data []byte) ([]byte, error) {
+	var graphData depgraph.GraphData
+	if err := yaml.Unmarshal(data, &graphData); err != nil {
+		return nil, err
+	}
+	return json.Marshal(graphData)
+}
+
+// checkXML checks that `data` is a well-formed XML document.
+func checkXML(data []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := dec.Token(); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func TestGraphWriters(t *testing.T) {
+	// The documents of the formats that hold the same fields as the JSON
+	// export, which must match its schema
+	schemaDocuments := map[string]func([]byte) ([]byte, error){
+		"json":  func(data []byte) ([]byte, error) { return data, nil },
+		"jsonl": jsonlDocument,
+		"yaml":  yamlDocument,
+	}
+	// How the other formats are checked
+	checks := map[string]func([]byte) error{
+		"cytoscape": func(data []byte) error {
+			if !json.Valid(data) {
+				return errors.New("not a JSON document")
+			}
+			return nil
+		},
+		"adjacency": func(data []byte) error {
+			if !json.Valid(data) {
+				return errors.New("not a JSON document")
+			}
+			return nil
+		},
+		"graphson": func(data []byte) error {
+			_, err := jsonLines(data)
+			return err
+		},
+		"graphml": checkXML,
+		"gexf":    checkXML,
+		"dot": func(data []byte) error {
+			if !bytes.HasPrefix(data, []byte("digraph")) {
+				return errors.New("not a DOT digraph")
+			}
+			return nil
+		},
+		"mermaid": func(data []byte) error {
+			if !bytes.HasPrefix(data, []byte("graph ")) {
+				return errors.New("not a Mermaid flowchart")
+			}
+			return nil
+		},
+	}
+
+	opts, err := depgraph.ParseEdgeKinds([]string{"all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.IncludeProvides = true
+	graphData := fixtureGraph(t, "rundeps", opts)
+
+	formats := make([]string, 0, len(graphWriters))
+	for format := range graphWriters {
+		formats = append(formats, format)
+	}
+	slices.Sort(formats)
+	for _, format := range formats {
+		data, err := graphWriters[format]().WriteGraph(graphData)
+		if err != nil {
+			t.Errorf("%s: failed to write the graph: %s", format, err)
+			continue
+		}
+		if len(data) == 0 {
+			t.Errorf("%s: wrote nothing", format)
+			continue
+		}
+
+		if toDocument, found := schemaDocuments[format]; found {
+			doc, err := toDocument(data)
+			if err != nil {
+				t.Errorf("%s: failed to read the export: %s", format, err)
+				continue
+			}
+			problems, err := depgraph.ValidateSchema(doc)
+			if err != nil {
+				t.Errorf("%s: %s", format, err)
+			}
+			for _, problem := range problems {
+				t.Errorf("%s: %s", format, problem)
+			}
+		} else if check, found := checks[format]; found {
+			if err = check(data); err != nil {
+				t.Errorf("%s: %s", format, err)
+			}
+		} else {
+			t.Errorf("%s: no check for this format", format)
+		}
+	}
+}
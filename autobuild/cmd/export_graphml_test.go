@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/GZGavinZhao/autobuild/depgraph"
+)
+
+// setGraphMLData sets the field of `dst`, a pointer to a node or an edge,
+// whose JSON name is the key of `data`.
+func setGraphMLData(dst any, data graphMLData) error {
+	val := reflect.ValueOf(dst).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		name, _, _ := strings.Cut(val.Type().Field(i).Tag.Get("json"), ",")
+		if name != data.Key {
+			continue
+		}
+		field := val.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(data.Value)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(data.Value)
+			if err != nil {
+				return err
+			}
+			field.SetBool(b)
+		case reflect.Int:
+			n, err := strconv.Atoi(data.Value)
+			if err != nil {
+				return err
+			}
+			field.SetInt(int64(n))
+		case reflect.Slice:
+			if data.Value != "" {
+				field.Set(reflect.ValueOf(strings.Split(data.Value, ",")))
+			}
+		default:
+			return fmt.Errorf("unsupported field %s", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("no field is named %s", data.Key)
+}
+
+// fromGraphML converts a GraphML document back into a graph, checking that
+// every attribute is declared for what it is set on.
+func fromGraphML(doc graphMLDocument) (res depgraph.GraphData, err error) {
+	declared := make(map[string]string)
+	for _, key := range doc.Keys {
+		declared[key.ID] = key.For
+	}
+	check := func(data graphMLData, kind string) error {
+		if declared[data.Key] != kind {
+			return fmt.Errorf("%s attribute %s is not declared", kind, data.Key)
+		}
+		return nil
+	}
+
+	for _, n := range doc.Graph.Nodes {
+		node := depgraph.GraphNode{ID: n.ID}
+		for _, data := range n.Data {
+			if err = check(data, "node"); err != nil {
+				return
+			}
+			if err = setGraphMLData(&node, data); err != nil {
+				return
+			}
+		}
+		res.Nodes = append(res.Nodes, node)
+	}
+	for _, e := range doc.Graph.Edges {
+		edge := depgraph.GraphEdge{ID: e.ID, Source: e.Source, Target: e.Target}
+		for _, data := range e.Data {
+			if err = check(data, "edge"); err != nil {
+				return
+			}
+			if err = setGraphMLData(&edge, data); err != nil {
+				return
+			}
+		}
+		res.Edges = append(res.Edges, edge)
+	}
+	return
+}
+
+func TestGraphMLRoundTrip(t *testing.T) {
+	opts := depgraph.DefaultOptions
+	opts.IncludeProvides = true
+	graphData := fixtureGraph(t, "emul32", opts)
+	graphData.Nodes[0].Highlighted = true
+
+	data, err := graphMLWriter{}.WriteGraph(graphData)
+	if err != nil {
+		t.Fatalf("Failed to export the graph as GraphML: %s", err)
+	}
+	var doc graphMLDocument
+	if err = xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to parse the GraphML export: %s", err)
+	}
+	if doc.XMLNS != graphMLNamespace || doc.Graph.EdgeDefault != "directed" {
+		t.Errorf("GraphML export has namespace %q and edge default %q", doc.XMLNS, doc.Graph.EdgeDefault)
+	}
+	got, err := fromGraphML(doc)
+	if err != nil {
+		t.Fatalf("Failed to read the GraphML export: %s", err)
+	}
+
+	want := jsonGraph(t, graphData)
+	if !reflect.DeepEqual(got.Nodes, want.Nodes) {
+		t.Errorf("GraphML nodes = %+v, want %+v", got.Nodes, want.Nodes)
+	}
+	if !reflect.DeepEqual(got.Edges, want.Edges) {
+		t.Errorf("GraphML edges = %+v, want %+v", got.Edges, want.Edges)
+	}
+}
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/GZGavinZhao/autobuild/depgraph"
+)
+
+const (
+	graphSONVertexLabel = "package"
+	graphSONEdgeLabel   = "depends"
+)
+
+// graphSONValue is a typed GraphSON 3.0 value, e.g. {"@type": "g:Int64",
+// "@value": 1}. Strings and booleans are written as plain JSON values.
+type graphSONValue struct {
+	Type  string `json:"@type"`
+	Value any    `json:"@value"`
+}
+
+func graphSONInt64(v int) graphSONValue { return graphSONValue{Type: "g:Int64", Value: v} }
+func graphSONInt32(v int) graphSONValue { return graphSONValue{Type: "g:Int32", Value: v} }
+
+type graphSONVertexProperty struct {
+	ID    graphSONValue `json:"id"`
+	Value any           `json:"value"`
+}
+
+// graphSONEdge is an edge as listed in the "outE" and "inE" of a vertex, which
+// only names the vertex at the other end.
+type graphSONEdge struct {
+	ID         graphSONValue  `json:"id"`
+	InV        *graphSONValue `json:"inV,omitempty"`
+	OutV       *graphSONValue `json:"outV,omitempty"`
+	Properties map[string]any `json:"properties"`
+}
+
+type graphSONVertex struct {
+	ID         graphSONValue                       `json:"id"`
+	Label      string                              `json:"label"`
+	OutE       map[string][]graphSONEdge           `json:"outE,omitempty"`
+	InE        map[string][]graphSONEdge           `json:"inE,omitempty"`
+	Properties map[string][]graphSONVertexProperty `json:"properties"`
+}
+
+// graphSONWriter encodes the graph in the GraphSON 3.0 adjacency list format
+// read by TinkerPop, e.g. with g.io("deps.json").read(): one "package" vertex
+// per line, listing its "depends" edges in "outE" and "inE". Vertices, edges
+// and vertex properties are numbered from 0 in the order of the graph.
+type graphSONWriter struct{}
+
+func (graphSONWriter) WriteGraph(graphData depgraph.GraphData) ([]byte, error) {
+	ids := make(map[string]int, len(graphData.Nodes))
+	vertices := make([]graphSONVertex, len(graphData.Nodes))
+	propID := 0
+	for idx, node := range graphData.Nodes {
+		ids[node.ID] = idx
+
+		properties := make(map[string][]graphSONVertexProperty)
+		addProperty := func(key string, value any) {
+			properties[key] = []graphSONVertexProperty{{ID: graphSONInt64(propID), Value: value}}
+			propID++
+		}
+		addProperty("name", node.ID)
+		addProperty("version", node.Version)
+		addProperty("release", graphSONInt32(node.Release))
+		addProperty("component", node.Component)
+		addProperty("isBase", node.IsBase)
+
+		vertices[idx] = graphSONVertex{
+			ID:         graphSONInt64(idx),
+			Label:      graphSONVertexLabel,
+			OutE:       make(map[string][]graphSONEdge),
+			InE:        make(map[string][]graphSONEdge),
+			Properties: properties,
+		}
+	}
+
+	for idx, edge := range graphData.Edges {
+		source, target := ids[edge.Source], ids[edge.Target]
+		inV, outV := graphSONInt64(target), graphSONInt64(source)
+		properties := map[string]any{
+			"kind":   edge.Kind,
+			"weight": graphSONInt32(edge.Weight),
+		}
+
+		vertices[source].OutE[graphSONEdgeLabel] = append(vertices[source].OutE[graphSONEdgeLabel], graphSONEdge{ID: graphSONInt64(idx), InV: &inV, Properties: properties})
+		vertices[target].InE[graphSONEdgeLabel] = append(vertices[target].InE[graphSONEdgeLabel], graphSONEdge{ID: graphSONInt64(idx), OutV: &outV, Properties: properties})
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, vertex := range vertices {
+		if err := enc.Encode(vertex); err != nil {
+			return nil, fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -5,21 +5,62 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
 	st "github.com/GZGavinZhao/autobuild/state"
-	"github.com/GZGavinZhao/autobuild/ypkg"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
+)
+
+// stdoutPath is the output path that stands for stdout.
+const stdoutPath = "-"
+
+const (
+	directionDepends   = "depends"
+	directionBuildflow = "buildflow"
+
+	virtualFirst = "first"
+	virtualAll   = "all"
 )
 
 var (
+	edgeKinds    []string
+	excludeBase  bool
+	noEmul32     bool
+	noOptional   bool
+	components   []string
+	jobs         int
+	traceProvs   bool
+	warnAmbig    bool
+	virtualPvds  string
+	direction    string
+	minFanin     int
+	pruneLeaves  int
+	followRun    bool
+	inducedDepth int
+	maxNodes     int
+	highlights   []string
+	includeProvs bool
+	focus        []string
+	dropDeps     string
+	focusRadius  int
+
+	incrementalPath string
+	compactJSON     bool
+
 	cmdExportJSON = &cobra.Command{
-		Use:   "export-json [src:path] [output]",
+		Use:   "export-json [src:path...] [output]",
 		Short: "Export dependency graph as JSON for visualization",
 		Long: `Export the package dependency graph as JSON format suitable for web visualization.
 
@@ -27,135 +68,401 @@ For example: autobuild export-json src:../packages2 ../depgraph/public/graph.jso
 
 This command parses all packages from the source repository and outputs a JSON file
 containing nodes (packages) and edges (dependencies) in a format that can be loaded
-by the depgraph web visualization tool.`,
-		Run: runExportJSON,
-		Args: func(cmd *cobra.Command, args []string) error {
-			if len(args) < 2 {
-				return errors.New("expects two args: source path and output file path")
-			}
-			return nil
-		},
+by the depgraph web visualization tool. It is equivalent to "export --format json".
+Every edge has an "id" that stays the same across exports as long as its
+packages and kind don't change, e.g. to animate the differences between two
+exports.
+
+Multiple source paths can be given to merge them into a single graph, e.g. when
+the recipes are split across repositories. Recipes from later paths override
+the ones with the same source name from earlier paths.
+
+Edges come from build dependencies by default, see --edges. Unresolved
+dependencies and self-dependencies are skipped. The flags below select which
+dependencies become edges, which packages are kept, and what the nodes record.
+Filters are applied in the order --exclude-base, --component, --min-fanin,
+--prune-leaves, then --max-nodes.
+
+Pass "-" as the output to write the JSON to stdout, e.g. to pipe it into jq. All
+logs are written to stderr in that case.`,
+		RunE: runExportJSON,
+		Args: exportArgs,
 	}
 )
 
-type GraphNode struct {
-	ID     string `json:"id"`
-	IsBase bool   `json:"isBase,omitempty"`
+func init() {
+	exportFlagsInit(cmdExportJSON)
+	compactFlagInit(cmdExportJSON)
+	cmdExportJSON.Flags().StringVar(&incrementalPath, "incremental", "", "reuse the packages of the export at `PATH` whose package.yml hasn't changed since it was written; dependencies are always recomputed, and the export must have the same --direction")
+	modeFlagInit(cmdExportJSON)
 }
 
-type GraphEdge struct {
-	Source string `json:"source"`
-	Target string `json:"target"`
+// exportFlagsInit registers the flags shared by every command that exports the
+// whole dependency graph.
+func exportFlagsInit(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&edgeKinds, "edges", []string{depgraph.EdgeBuild}, "kinds of dependencies to export as edges: build, runtime for the \"rundeps\" of package.yml, or all for both")
+	cmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.GOMAXPROCS(0), "number of package.yml files to parse concurrently")
+	cmd.Flags().BoolVar(&excludeBase, "exclude-base", false, "drop base packages, see --base-prefix, and every dependency on them")
+	cmd.Flags().StringArrayVar(&components, "component", nil, "only keep packages whose component starts with `PATTERN`, ignoring case; may be repeated")
+	cmd.Flags().BoolVar(&traceProvs, "trace-providers", false, "log the package that every dependency resolves to, and warn about providers declared by more than one package")
+	cmd.Flags().StringVar(&virtualPvds, "virtual-providers", virtualFirst, "how to resolve providers declared by several recipes: \"first\" for the one named after the provider, or else the first by name, or \"all\" for an edge marked \"virtual\" to each of the others as well")
+	cmd.Flags().BoolVar(&warnAmbig, "warn-ambiguous", false, "warn about every provider declared by more than one source recipe, listing all of them and the one it resolves to")
+	cmd.Flags().BoolVar(&includeProvs, "include-provides", false, "list the providers of every package, e.g. pkgconfig(foo), in its \"provides\" field, which makes the export much bigger")
+	cmd.Flags().BoolVar(&noEmul32, "no-emul32", false, "drop build dependencies that are only needed for the 32-bit build")
+	cmd.Flags().BoolVar(&followRun, "follow-runtime-of-build-deps", false, "add \"induced-runtime\" edges to the runtime dependencies of the build dependencies, as they are installed along with them, except to packages that are build dependencies already")
+	cmd.Flags().IntVar(&inducedDepth, "induced-depth", 3, "maximum number of runtime dependencies to follow from a build dependency with --follow-runtime-of-build-deps")
+	cmd.Flags().BoolVar(&noOptional, "no-optional", false, "drop the \"optional\" edges of the checkdeps of package.yml, which are only needed to run the check step")
+	cmd.Flags().StringVar(&dropDeps, "drop-edge-matching", "", "skip the dependencies whose name as declared in package.yml matches `REGEX`, e.g. \"^pkgconfig\\(\", before resolving them, logging how many were dropped")
+	cmd.Flags().IntVar(&minFanin, "min-fanin", 0, "only keep packages that at least `N` packages depend on, counted after --exclude-base and --component, along with the edges among them")
+	cmd.Flags().IntVar(&pruneLeaves, "prune-leaves", 0, "remove the packages without dependencies `N` times over, as removing them turns their dependents into such packages, keeping the core of the graph")
+	cmd.Flags().IntVar(&maxNodes, "max-nodes", 0, "only keep the `N` packages with the most dependents, ties broken by name, if the graph has more, warning when it does; unlimited if not positive")
+	cmd.Flags().StringArrayVar(&highlights, "highlight", nil, "mark the packages matching `PATTERN`, a name or a shell-style glob, as highlighted; may be repeated")
+	cmd.Flags().StringArrayVar(&focus, "focus", nil, "only keep the packages within --radius hops of the packages matching `PATTERN` in either direction, and highlight the latter; may be repeated")
+	cmd.Flags().IntVar(&focusRadius, "radius", 1, "maximum number of hops from the --focus packages")
+	cmd.Flags().StringVar(&direction, "direction", directionDepends, "meaning of an edge from A to B: \"depends\" if A depends on B, or \"buildflow\" if B depends on A, so that edges follow the build order")
 }
 
-type GraphData struct {
-	Nodes []GraphNode `json:"nodes"`
-	Edges []GraphEdge `json:"edges"`
+// compactFlagInit registers the --compact flag of the commands that write the
+// graph as JSON.
+func compactFlagInit(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&compactJSON, "compact", false, "write the JSON without indentation, which makes it much smaller")
 }
 
-func isBaseComponent(component yaml.Node) bool {
-	if component.Kind == yaml.ScalarNode {
-		val := strings.ToLower(component.Value)
-		return strings.HasPrefix(val, "system.base") || strings.HasPrefix(val, "system.devel")
-	} else if component.Kind == yaml.MappingNode {
-		// Handle split packages like ^libgcc : system.base
-		for _, node := range component.Content {
-			if node.Kind == yaml.ScalarNode {
-				val := strings.ToLower(node.Value)
-				if strings.HasPrefix(val, "system.base") || strings.HasPrefix(val, "system.devel") {
-					return true
-				}
-			}
+// exportOptions returns the graph options selected by the flags registered by
+// exportFlagsInit.
+func exportOptions() (depgraph.Options, error) {
+	opts, err := depgraph.ParseEdgeKinds(edgeKinds)
+	if err != nil {
+		return opts, fmt.Errorf("Invalid --edges: %w", err)
+	}
+	opts.Jobs = jobs
+	opts.SkipEmul32 = noEmul32
+	opts.SkipOptional = noOptional
+	opts.TraceProviders = traceProvs
+	switch virtualPvds {
+	case virtualFirst:
+	case virtualAll:
+		opts.AllProviders = true
+	default:
+		return opts, fmt.Errorf("Invalid --virtual-providers %s, must be either %s or %s", virtualPvds, virtualFirst, virtualAll)
+	}
+	opts.IncludeProvides = includeProvs
+	opts.ExcludeBase = excludeBase
+	opts.Components = components
+	opts.MinFanin = minFanin
+	opts.PruneLeaves = pruneLeaves
+	if followRun {
+		if !opts.BuildEdges {
+			return opts, errors.New("--follow-runtime-of-build-deps needs build edges, see --edges")
+		}
+		if inducedDepth <= 0 {
+			return opts, fmt.Errorf("Invalid --induced-depth %d, must be positive", inducedDepth)
+		}
+		opts.InducedRuntimeDepth = inducedDepth
+	}
+	opts.MaxNodes = maxNodes
+	if dropDeps != "" {
+		if opts.DropDeps, err = regexp.Compile(dropDeps); err != nil {
+			return opts, fmt.Errorf("Invalid --drop-edge-matching: %w", err)
 		}
 	}
-	return false
+	if direction != directionDepends && direction != directionBuildflow {
+		return opts, fmt.Errorf("Invalid --direction %s, must be either %s or %s", direction, directionDepends, directionBuildflow)
+	}
+	opts.Reverse = direction == directionBuildflow
+
+	if incrementalPath != "" {
+		if opts.Previous, opts.PreviousEdges, opts.PreviousTime, err = loadPreviousGraph(incrementalPath); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
 }
 
-func runExportJSON(cmd *cobra.Command, args []string) {
-	tpath := args[0]
-	outputPath := args[1]
+// loadPreviousGraph loads the nodes and edges of the graph exported to `path`
+// as JSON, along with the time the file was last written.
+func loadPreviousGraph(path string) (nodes map[string]depgraph.GraphNode, edges []depgraph.GraphEdge, modTime time.Time, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		err = fmt.Errorf("Failed to read previous export: %w", err)
+		return
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("Failed to read previous export: %w", err)
+		return
+	}
+
+	var graphData depgraph.GraphData
+	if err = json.Unmarshal(raw, &graphData); err != nil {
+		err = fmt.Errorf("Failed to parse previous export %s: %w", path, err)
+		return
+	}
+	if graphData.SchemaVersion != depgraph.SchemaVersion {
+		waterlog.Warnf("Previous export %s has schema version %d instead of %d, not reusing any package\n", path, graphData.SchemaVersion, depgraph.SchemaVersion)
+		return nil, nil, info.ModTime(), nil
+	}
+
+	nodes = make(map[string]depgraph.GraphNode, len(graphData.Nodes))
+	for _, node := range graphData.Nodes {
+		nodes[node.ID] = node
+	}
+	return nodes, graphData.Edges, info.ModTime(), nil
+}
+
+// exportGraph loads the states at `tpaths`, merged into one, and builds the
+// graph to export according to the flags registered by exportFlagsInit.
+func exportGraph(ctx context.Context, tpaths []string) (depgraph.GraphData, error) {
+	state, opts, err := exportState(ctx, tpaths)
+	if err != nil {
+		return depgraph.GraphData{}, err
+	}
+	return exportStateGraph(ctx, state, opts)
+}
+
+// exportState loads the states at `tpaths`, merged into one, along with the
+// options to build its graph with according to the flags.
+func exportState(ctx context.Context, tpaths []string) (st.State, depgraph.Options, error) {
+	opts, err := exportOptions()
+	if err != nil {
+		return nil, opts, err
+	}
 
 	// Load source state
-	state, err := st.LoadState(tpath)
+	state, err := st.LoadStates(ctx, tpaths, loadJobs)
 	if err != nil {
-		waterlog.Fatalf("Failed to parse state: %s\n", err)
+		return nil, opts, fmt.Errorf("Failed to parse state: %w", err)
 	}
 	waterlog.Goodln("Successfully parsed state!")
+	if warnAmbig {
+		warnAmbiguousProviders(state)
+	}
+	return state, opts, nil
+}
 
-	packages := state.Packages()
-	pvdToPkgIdx := state.PvdToPkgIdx()
+// exportStateGraph builds the graph of `state` with `opts` and focuses and
+// highlights it according to the flags.
+func exportStateGraph(ctx context.Context, state st.State, opts depgraph.Options) (depgraph.GraphData, error) {
+	graphData, err := buildGraph(ctx, state, opts)
+	if err != nil {
+		return graphData, err
+	}
+	if len(focus) > 0 {
+		if graphData, err = focusGraph(graphData, focus, focusRadius); err != nil {
+			return graphData, err
+		}
+		if err = highlightNodes(graphData, focus); err != nil {
+			return graphData, err
+		}
+	}
+	if len(highlights) > 0 {
+		if err = highlightNodes(graphData, highlights); err != nil {
+			return graphData, err
+		}
+	}
 
-	// Build nodes and edges
-	nodes := make([]GraphNode, 0, len(packages))
-	edges := make([]GraphEdge, 0)
+	return graphData, nil
+}
 
-	// Track which packages we've seen to avoid duplicates
-	seenPackages := make(map[string]bool)
+// warnAmbiguousProviders warns about every provider of `state` that more than
+// one source recipe declares, since dependencies on it may not resolve to the
+// intended recipe.
+func warnAmbiguousProviders(state st.State) {
+	ambiguous := depgraph.AmbiguousProviders(state)
+	pvds := make([]string, 0, len(ambiguous))
+	for pvd := range ambiguous {
+		pvds = append(pvds, pvd)
+	}
+	slices.Sort(pvds)
 
-	for _, pkg := range packages {
-		// Skip if we've already added this package
-		if seenPackages[pkg.Source] {
-			continue
-		}
-		seenPackages[pkg.Source] = true
+	for _, pvd := range pvds {
+		srcs := ambiguous[pvd]
+		waterlog.Warnf("%s is provided by %s, resolving to %s\n", pvd, strings.Join(srcs, ", "), srcs[0])
+	}
+	if len(pvds) > 0 {
+		waterlog.Warnf("Found %d providers declared by more than one recipe\n", len(pvds))
+	} else {
+		waterlog.Goodln("No provider is declared by more than one recipe!")
+	}
+}
 
-		// Load package.yml to get component information
-		pkgYml, err := ypkg.Load(pkg.Path + "/package.yml")
-		isBase := false
-		if err == nil {
-			isBase = isBaseComponent(pkgYml.Component)
+// focusGraph returns the part of the graph within `radius` hops of the
+// packages matching any of `patterns`, no matter the direction of the edges.
+func focusGraph(graphData depgraph.GraphData, patterns []string, radius int) (depgraph.GraphData, error) {
+	gi := newGraphIndex(graphData)
+	var starts []int
+	for _, pattern := range patterns {
+		matched, err := matchPackages(gi, pattern, false)
+		if err != nil {
+			return depgraph.GraphData{}, err
 		}
+		if len(matched) == 0 {
+			waterlog.Warnf("%s\n", unknownPackage(gi, pattern))
+		}
+		starts = append(starts, matched...)
+	}
+	if len(starts) == 0 {
+		return depgraph.GraphData{}, errors.New("No package matches --focus")
+	}
 
-		// Add node
-		nodes = append(nodes, GraphNode{
-			ID:     pkg.Source,
-			IsBase: isBase,
-		})
-
-		// Add edges for build dependencies
-		for _, dep := range pkg.BuildDeps {
-			// Resolve dependency to package index
-			depIdx, found := pvdToPkgIdx[dep]
-			if !found {
-				// Skip dependencies that couldn't be resolved
-				continue
-			}
-
-			depPkg := packages[depIdx]
+	keep := gi.neighborhood(starts, radius)
+	res := graphData.Subgraph(func(node depgraph.GraphNode) bool { return keep[gi.ids[node.ID]] })
+	waterlog.Infof("Kept %d packages within %d hops of the focused ones\n", len(res.Nodes), radius)
+	return res, nil
+}
 
-			// Skip self-dependencies
-			if pkg.Source == depPkg.Source {
-				continue
+// highlightNodes marks the nodes matching any of `patterns` as highlighted.
+func highlightNodes(graphData depgraph.GraphData, patterns []string) error {
+	gi := newGraphIndex(graphData)
+	count := 0
+	for _, pattern := range patterns {
+		matched, err := matchPackages(gi, pattern, false)
+		if err != nil {
+			return err
+		}
+		if len(matched) == 0 {
+			waterlog.Warnf("No package matches %s\n", pattern)
+		}
+		for _, v := range matched {
+			if !graphData.Nodes[v].Highlighted {
+				graphData.Nodes[v].Highlighted = true
+				count++
 			}
-
-			// Add edge: pkg depends on depPkg
-			// Direction: source → target means "source depends on target"
-			edges = append(edges, GraphEdge{
-				Source: pkg.Source,
-				Target: depPkg.Source,
-			})
 		}
 	}
+	waterlog.Infof("Highlighted %d packages\n", count)
+	return nil
+}
 
-	// Create graph data structure
-	graphData := GraphData{
-		Nodes: nodes,
-		Edges: edges,
+func runExportJSON(cmd *cobra.Command, args []string) error {
+	return runExportWith(cmd.Context(), args, jsonWriter{compact: compactJSON})
+}
+
+// jsonWriter encodes the graph in the JSON format of the depgraph web
+// visualization, indented unless `compact` is set.
+type jsonWriter struct {
+	compact bool
+}
+
+func (w jsonWriter) WriteGraph(graphData depgraph.GraphData) (jsonData []byte, err error) {
+	if w.compact {
+		jsonData, err = json.Marshal(graphData)
+	} else {
+		jsonData, err = json.MarshalIndent(graphData, "", "  ")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal JSON: %w", err)
 	}
+	return jsonData, nil
+}
 
-	// Marshal to JSON
-	jsonData, err := json.MarshalIndent(graphData, "", "  ")
+// writeGraphJSON marshals the graph to JSON according to --compact and writes
+// it to `outputPath`, returning the number of bytes written.
+func writeGraphJSON(graphData depgraph.GraphData, outputPath string) (int, error) {
+	jsonData, err := jsonWriter{compact: compactJSON}.WriteGraph(graphData)
 	if err != nil {
-		waterlog.Fatalf("Failed to marshal JSON: %s\n", err)
+		return 0, err
+	}
+
+	return len(jsonData), writeOutput(outputPath, jsonData)
+}
+
+// fileModeFlag is the value of a --mode flag, the permissions of a file given
+// as an octal number.
+type fileModeFlag struct {
+	mode os.FileMode
+	// Whether the flag has been given, in which case the mode is applied to
+	// existing files as well and regardless of the umask.
+	set bool
+}
+
+func (f *fileModeFlag) String() string {
+	return fmt.Sprintf("%04o", uint32(f.mode))
+}
+
+func (f *fileModeFlag) Set(value string) error {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return errors.New("must be an octal permission between 0000 and 0777, e.g. 0644 or 0640")
+	}
+	f.mode = os.FileMode(mode)
+	f.set = true
+	return nil
+}
+
+func (f *fileModeFlag) Type() string {
+	return "mode"
+}
+
+// outputMode holds the --mode flag registered by modeFlagInit.
+var outputMode = fileModeFlag{mode: 0644}
+
+// modeFlagInit registers the --mode flag of the commands that write files.
+func modeFlagInit(cmd *cobra.Command) {
+	cmd.Flags().Var(&outputMode, "mode", "exact permissions of the output files as an octal number, e.g. 0640, even if they already exist; if unset, new files get the default minus the umask")
+}
+
+// applyOutputMode sets the permissions of `outputPath` to --mode if it has
+// been given, since creating a file applies the umask to them and writing to
+// an existing one keeps them as they are.
+func applyOutputMode(outputPath string) error {
+	if !outputMode.set {
+		return nil
+	}
+	if err := os.Chmod(outputPath, outputMode.mode); err != nil {
+		return fmt.Errorf("Failed to set the permissions of the output file: %w", err)
+	}
+	return nil
+}
+
+// writeOutput writes `data` to `outputPath` with the permissions given by
+// --mode, or to stdout if it is "-".
+func writeOutput(outputPath string, data []byte) (err error) {
+	if outputPath == stdoutPath {
+		_, err = os.Stdout.Write(data)
+	} else if err = os.WriteFile(outputPath, data, outputMode.mode); err == nil {
+		return applyOutputMode(outputPath)
 	}
 
-	// Write to file
-	err = os.WriteFile(outputPath, jsonData, 0644)
 	if err != nil {
-		waterlog.Fatalf("Failed to write output file: %s\n", err)
+		return fmt.Errorf("Failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// redirectLogs sends all log output to stderr when the exported data goes to
+// stdout, so that the two don't get mixed up.
+func redirectLogs(outputPath string) {
+	if outputPath == stdoutPath {
+		waterlog.SetOutput(os.Stderr)
+	}
+}
+
+// reportExport prints a summary of the graph that has been written to
+// `outputPath` as `size` bytes.
+func reportExport(graphData depgraph.GraphData, outputPath string, size int) {
+	cyclic := 0
+	for _, node := range graphData.Nodes {
+		if node.Depth < 0 {
+			cyclic++
+		}
 	}
+	reportCounts(outputPath, len(graphData.Nodes), len(graphData.Edges), cyclic, size)
+}
 
+// reportCounts prints the summary of reportExport for a graph of `nodes`
+// packages, `cyclic` of which are part of a dependency cycle, and `edges`
+// dependencies.
+func reportCounts(outputPath string, nodes int, edges int, cyclic int, size int) {
+	if outputPath == stdoutPath {
+		outputPath = "stdout"
+	}
 	waterlog.Goodf("Successfully exported graph to %s\n", outputPath)
-	waterlog.Goodf("  Nodes: %d packages\n", len(nodes))
-	waterlog.Goodf("  Edges: %d dependencies\n", len(edges))
+	waterlog.Goodf("  Nodes: %d packages\n", nodes)
+	waterlog.Goodf("  Edges: %d dependencies\n", edges)
+	waterlog.Goodf("  Size: %d bytes\n", size)
+	if cyclic > 0 {
+		waterlog.Infof("%d packages are part of a dependency cycle and have no depth\n", cyclic)
+	}
 }
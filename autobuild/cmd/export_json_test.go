@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GZGavinZhao/autobuild/depgraph"
+)
+
+func TestIncrementalExport(t *testing.T) {
+	dir := copyFixture(t, "rundeps")
+	opts, err := depgraph.ParseEdgeKinds([]string{"all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.IncludeProvides = true
+	generatedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	export := func(opts depgraph.Options) []byte {
+		t.Helper()
+		graphData := buildDir(t, dir, opts)
+		graphData.GeneratedAt = generatedAt
+		data, err := jsonWriter{}.WriteGraph(graphData)
+		if err != nil {
+			t.Fatalf("Failed to export the graph as JSON: %s", err)
+		}
+		return data
+	}
+
+	// The previous export is newer than every recipe but the edited one
+	prevPath := filepath.Join(t.TempDir(), "graph.json")
+	if err = os.WriteFile(prevPath, export(opts), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err = os.Chtimes(prevPath, now.Add(time.Minute), now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	recipe := filepath.Join(dir, "lib", "package.yml")
+	packageYml, err := os.ReadFile(recipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(packageYml), "release: 3", "release: 4", 1)
+	if edited == string(packageYml) {
+		t.Fatalf("%s has no release to bump", recipe)
+	}
+	if err = os.WriteFile(recipe, []byte(edited+"rundeps:\n  - tool\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(recipe, now.Add(2*time.Minute), now.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	full := export(opts)
+	if opts.Previous, opts.PreviousEdges, opts.PreviousTime, err = loadPreviousGraph(prevPath); err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.Previous) == 0 {
+		t.Fatalf("no packages loaded from the previous export")
+	}
+	if incremental := export(opts); !bytes.Equal(incremental, full) {
+		t.Errorf("incremental export differs from the full one:\n%s\nwant:\n%s", incremental, full)
+	}
+	if !strings.Contains(string(full), `"release": 4`) {
+		t.Errorf("export doesn't have the edited release:\n%s", full)
+	}
+}
@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	"github.com/GZGavinZhao/autobuild/utils"
+)
+
+// GraphStreamer is implemented by the GraphWriters that can write the graph
+// to `w` as `walk` hands its parts to their visitor, rather than needing it
+// all at once.
+type GraphStreamer interface {
+	StreamGraph(w io.Writer, walk func(depgraph.Visitor) error) error
+}
+
+// jsonlHeader is the first line of the JSON Lines export.
+type jsonlHeader struct {
+	Type          string    `json:"type"`
+	SchemaVersion int       `json:"schemaVersion"`
+	GeneratedAt   time.Time `json:"generatedAt"`
+}
+
+type jsonlNode struct {
+	Type string `json:"type"`
+	depgraph.GraphNode
+}
+
+type jsonlEdge struct {
+	Type string `json:"type"`
+	depgraph.GraphEdge
+}
+
+// jsonlWriter encodes the graph as JSON Lines: a "graph" object with the
+// schema version, followed by one "node" object per package and one "edge"
+// object per dependency, with the same fields as in the JSON export.
+type jsonlWriter struct{}
+
+func (w jsonlWriter) WriteGraph(graphData depgraph.GraphData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := w.StreamGraph(&buf, graphData.Visit); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (jsonlWriter) StreamGraph(w io.Writer, walk func(depgraph.Visitor) error) error {
+	bw := bufio.NewWriter(w)
+	if err := walk(jsonlEncoder{json.NewEncoder(bw)}); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("Failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// jsonlEncoder writes every part of the graph it visits as a line of JSON.
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func (e jsonlEncoder) encode(v any) error {
+	if err := e.enc.Encode(v); err != nil {
+		return fmt.Errorf("Failed to marshal JSON: %w", err)
+	}
+	return nil
+}
+
+func (e jsonlEncoder) VisitHeader(schemaVersion int, generatedAt time.Time) error {
+	return e.encode(jsonlHeader{Type: "graph", SchemaVersion: schemaVersion, GeneratedAt: generatedAt})
+}
+
+func (e jsonlEncoder) VisitNode(node depgraph.GraphNode) error {
+	return e.encode(jsonlNode{Type: "node", GraphNode: node})
+}
+
+func (e jsonlEncoder) VisitEdge(edge depgraph.GraphEdge) error {
+	return e.encode(jsonlEdge{Type: "edge", GraphEdge: edge})
+}
+
+// visitCounter counts the nodes and edges that it passes on to its Visitor,
+// for reportCounts.
+type visitCounter struct {
+	depgraph.Visitor
+	nodes  int
+	edges  int
+	cyclic int
+}
+
+func (vc *visitCounter) VisitNode(node depgraph.GraphNode) error {
+	vc.nodes++
+	if node.Depth < 0 {
+		vc.cyclic++
+	}
+	return vc.Visitor.VisitNode(node)
+}
+
+func (vc *visitCounter) VisitEdge(edge depgraph.GraphEdge) error {
+	vc.edges++
+	return vc.Visitor.VisitEdge(edge)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += n
+	return n, err
+}
+
+// streamOutput streams the graph handed out by `walk` to `outputPath`, or to
+// stdout if it is "-", returning the number of bytes written.
+func streamOutput(outputPath string, streamer GraphStreamer, walk func(depgraph.Visitor) error) (int, error) {
+	if outputPath == stdoutPath {
+		cw := &countingWriter{w: os.Stdout}
+		err := streamer.StreamGraph(cw, walk)
+		return cw.n, err
+	}
+
+	f, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, outputMode.mode)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to write output file: %w", err)
+	}
+	cw := &countingWriter{w: f}
+	err = streamer.StreamGraph(cw, walk)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("Failed to write output file: %w", closeErr)
+	}
+	if err == nil {
+		err = applyOutputMode(outputPath)
+	}
+	return cw.n, err
+}
+
+// streamExport exports the graph of the states at `tpaths` to `outputPath`
+// with `streamer`. Its nodes and edges are written as depgraph.Stream
+// resolves them, unless the flags need the whole graph first, e.g. to filter
+// or focus it.
+func streamExport(ctx context.Context, tpaths []string, outputPath string, streamer GraphStreamer) error {
+	state, opts, err := exportState(ctx, tpaths)
+	if err != nil {
+		return err
+	}
+
+	if !opts.CanStream() || len(focus) > 0 || len(highlights) > 0 {
+		waterlog.Debugln("Building the whole graph before writing it, since the flags need it")
+		graphData, err := exportStateGraph(ctx, state, opts)
+		if err != nil {
+			return err
+		}
+		defer utils.TrackPhase("encoding and writing the graph")()
+		size, err := streamOutput(outputPath, streamer, graphData.Visit)
+		if err != nil {
+			return err
+		}
+		reportExport(graphData, outputPath, size)
+		return nil
+	}
+
+	if opts, err = graphOptions(state, opts); err != nil {
+		return err
+	}
+	counter := &visitCounter{}
+	size, err := streamOutput(outputPath, streamer, func(v depgraph.Visitor) error {
+		counter.Visitor = v
+		return depgraph.Stream(ctx, state, opts, counter)
+	})
+	if err != nil {
+		return err
+	}
+	reportCounts(outputPath, counter.nodes, counter.edges, counter.cyclic, size)
+	return nil
+}
@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withoutHeader returns the lines of a JSON Lines export after its header,
+// which holds the time of the export.
+func withoutHeader(t *testing.T, data []byte) []byte {
+	t.Helper()
+	_, rest, found := bytes.Cut(data, []byte("\n"))
+	if !found {
+		t.Fatalf("export has no header line:\n%s", data)
+	}
+	return rest
+}
+
+func TestStreamExport(t *testing.T) {
+	tpaths := []string{"src:" + fixtureDir("rundeps")}
+	prevExcludeBase := excludeBase
+	t.Cleanup(func() { excludeBase = prevExcludeBase })
+
+	// Streamed, and built in full since the filter needs the whole graph
+	for _, exclude := range []bool{false, true} {
+		excludeBase = exclude
+		graphData, err := exportGraph(context.Background(), tpaths)
+		if err != nil {
+			t.Fatalf("Failed to build the graph: %s", err)
+		}
+		want, err := jsonlWriter{}.WriteGraph(graphData)
+		if err != nil {
+			t.Fatalf("Failed to export the graph as JSON Lines: %s", err)
+		}
+
+		outputPath := filepath.Join(t.TempDir(), "graph.jsonl")
+		if err = streamExport(context.Background(), tpaths, outputPath, jsonlWriter{}); err != nil {
+			t.Fatalf("Failed to stream the graph: %s", err)
+		}
+		got, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(withoutHeader(t, got), withoutHeader(t, want)) {
+			t.Errorf("streamed export with --exclude-base=%t:\n%s\nwant:\n%s", exclude, got, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+)
+
+const (
+	mermaidBaseFillColor = "lightblue"
+
+	// mermaidMaxNodes is the number of nodes above which Mermaid diagrams are
+	// too cluttered to be read.
+	mermaidMaxNodes = 100
+)
+
+// mermaidIDs maps every node to an identifier that Mermaid accepts, i.e. with
+// every character other than letters, digits and underscores replaced by an
+// underscore. Collisions are resolved by appending a counter. The labels of the
+// nodes keep their real names.
+func mermaidIDs(nodes []depgraph.GraphNode) map[string]string {
+	res := make(map[string]string, len(nodes))
+	used := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		id := strings.Map(func(r rune) rune {
+			if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return '_'
+		}, node.ID)
+		// "end" closes subgraphs, so it can't be used as an identifier
+		if strings.EqualFold(id, "end") {
+			id += "_"
+		}
+		for base, n := id, 2; used[id]; n++ {
+			id = fmt.Sprintf("%s_%d", base, n)
+		}
+		used[id] = true
+		res[node.ID] = id
+	}
+	return res
+}
+
+// mermaidWriter encodes the graph as a Mermaid flowchart, laid out from left
+// to right, to be embedded in Markdown.
+type mermaidWriter struct{}
+
+func (w mermaidWriter) WriteGraph(graphData depgraph.GraphData) ([]byte, error) {
+	if len(graphData.Nodes) > mermaidMaxNodes {
+		waterlog.Warnf("Mermaid diagrams with more than %d packages are hard to read, consider exporting a subgraph first\n", mermaidMaxNodes)
+	}
+
+	ids := mermaidIDs(graphData.Nodes)
+	var sb strings.Builder
+	var base []string
+
+	sb.WriteString("graph LR\n")
+	for _, node := range graphData.Nodes {
+		fmt.Fprintf(&sb, "\t%s[\"%s\"]\n", ids[node.ID], strings.ReplaceAll(node.ID, `"`, "#quot;"))
+		if node.IsBase {
+			base = append(base, ids[node.ID])
+		}
+	}
+	for _, edge := range graphData.Edges {
+		fmt.Fprintf(&sb, "\t%s --> %s\n", ids[edge.Source], ids[edge.Target])
+	}
+	if len(base) > 0 {
+		fmt.Fprintf(&sb, "\tclassDef base fill:%s\n", mermaidBaseFillColor)
+		fmt.Fprintf(&sb, "\tclass %s base\n", strings.Join(base, ","))
+	}
+
+	return []byte(sb.String()), nil
+}
@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	"github.com/GZGavinZhao/autobuild/utils"
+)
+
+// splitGraphFile is the name of the graph written for every component by
+// export --split-by-component.
+const splitGraphFile = "graph.json"
+
+// splitIndex is the index.json written by export --split-by-component.
+type splitIndex struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	Components    []splitComponent `json:"components"`
+}
+
+// splitComponent is the entry of a component in a splitIndex.
+type splitComponent struct {
+	Component string `json:"component"`
+	// File is the path of the graph of the component, relative to the index.
+	File     string `json:"file"`
+	Packages int    `json:"packages"`
+	External int    `json:"external"`
+}
+
+// nodeComponents returns the distinct components of every package of the
+// graph, sorted. Split packages belong to each of their components.
+func nodeComponents(graphData depgraph.GraphData) (res []string) {
+	for _, node := range graphData.Nodes {
+		for _, component := range strings.Split(node.Component, ",") {
+			if component != "" && !slices.Contains(res, component) {
+				res = append(res, component)
+			}
+		}
+	}
+	slices.Sort(res)
+	return
+}
+
+// componentDir turns a component into the name of the directory its graph is
+// written to, so that it can't escape the output directory.
+func componentDir(component string) string {
+	name := strings.NewReplacer("/", "_", `\`, "_").Replace(component)
+	if name == "." || name == ".." {
+		name = strings.Repeat("_", len(name))
+	}
+	return name
+}
+
+// runSplitExport exports the graph of the states at `tpaths` to one JSON file
+// per component in `outputDir`, along with an index.json listing them.
+func runSplitExport(ctx context.Context, tpaths []string, outputDir string) error {
+	graphData, err := exportGraph(ctx, tpaths)
+	if err != nil {
+		return err
+	}
+	defer utils.TrackPhase("encoding and writing the graph")()
+	writer := jsonWriter{compact: compactJSON}
+	if err = os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("Failed to create output directory: %w", err)
+	}
+
+	index := splitIndex{
+		SchemaVersion: depgraph.SchemaVersion,
+		Components:    make([]splitComponent, 0),
+	}
+	for _, component := range nodeComponents(graphData) {
+		subgraph := graphData.WithBoundary(func(node depgraph.GraphNode) bool {
+			return slices.Contains(strings.Split(node.Component, ","), component)
+		})
+
+		entry := splitComponent{
+			Component: component,
+			File:      filepath.ToSlash(filepath.Join(componentDir(component), splitGraphFile)),
+		}
+		for _, node := range subgraph.Nodes {
+			if node.External {
+				entry.External++
+			} else {
+				entry.Packages++
+			}
+		}
+
+		data, err := writer.WriteGraph(subgraph)
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Join(outputDir, componentDir(component)), 0755); err != nil {
+			return fmt.Errorf("Failed to create output directory: %w", err)
+		}
+		if err = writeOutput(filepath.Join(outputDir, entry.File), data); err != nil {
+			return err
+		}
+		waterlog.Infof("Wrote %s with %d packages and %d external ones\n", entry.File, entry.Packages, entry.External)
+		index.Components = append(index.Components, entry)
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to marshal JSON: %w", err)
+	}
+	indexPath := filepath.Join(outputDir, "index.json")
+	if err = writeOutput(indexPath, data); err != nil {
+		return err
+	}
+	waterlog.Goodf("Successfully exported %d components to %s\n", len(index.Components), outputDir)
+	return nil
+}
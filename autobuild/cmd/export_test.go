@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/ypkg"
+)
+
+func TestMain(m *testing.M) {
+	// Don't leave the fixtures in the cache of the user
+	ypkg.CacheEnabled = false
+	os.Exit(m.Run())
+}
+
+// fixtureDir returns the directory of the depgraph fixture `name`.
+func fixtureDir(name string) string {
+	return filepath.Join("..", "depgraph", "testdata", name)
+}
+
+// copyFixture copies the recipes of the depgraph fixture `name` to a temporary
+// directory, so that they can be modified, and returns its path.
+func copyFixture(t testing.TB, name string) string {
+	t.Helper()
+	src := fixtureDir(name)
+	dst := t.TempDir()
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, rel), data, 0644)
+	})
+	if err != nil {
+		t.Fatalf("Failed to copy fixture %s: %s", name, err)
+	}
+	return dst
+}
+
+// buildDir builds the graph of the recipes under `dir`.
+func buildDir(t testing.TB, dir string, opts depgraph.Options) depgraph.GraphData {
+	t.Helper()
+	state, err := st.LoadState(context.Background(), "src:"+dir)
+	if err != nil {
+		t.Fatalf("Failed to load %s: %s", dir, err)
+	}
+	graphData, err := depgraph.Build(context.Background(), state, opts)
+	if err != nil {
+		t.Fatalf("Failed to build the graph of %s: %s", dir, err)
+	}
+	return graphData
+}
+
+// fixtureGraph builds the graph of the recipes in the depgraph fixture `name`.
+func fixtureGraph(t testing.TB, name string, opts depgraph.Options) depgraph.GraphData {
+	t.Helper()
+	return buildDir(t, fixtureDir(name), opts)
+}
+
+// jsonGraph returns the graph as read back from its JSON export.
+func jsonGraph(t testing.TB, graphData depgraph.GraphData) depgraph.GraphData {
+	t.Helper()
+	data, err := jsonWriter{}.WriteGraph(graphData)
+	if err != nil {
+		t.Fatalf("Failed to export the graph as JSON: %s", err)
+	}
+	var res depgraph.GraphData
+	if err = json.Unmarshal(data, &res); err != nil {
+		t.Fatalf("Failed to parse the JSON export: %s", err)
+	}
+	return res
+}
@@ -0,0 +1,24 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlWriter encodes the graph as YAML, with the same structure and keys as
+// the JSON export.
+type yamlWriter struct{}
+
+func (w yamlWriter) WriteGraph(graphData depgraph.GraphData) ([]byte, error) {
+	data, err := yaml.Marshal(graphData)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal YAML: %w", err)
+	}
+	return data, nil
+}
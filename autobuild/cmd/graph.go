@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/yourbasic/graph"
+)
+
+// buildGraph builds the dependency graph of `state` with depgraph.Build and
+// the options of graphOptions.
+func buildGraph(ctx context.Context, state st.State, opts depgraph.Options) (depgraph.GraphData, error) {
+	opts, err := graphOptions(state, opts)
+	if err != nil {
+		return depgraph.GraphData{}, err
+	}
+
+	graphData, err := depgraph.Build(ctx, state, opts)
+	if err != nil {
+		return depgraph.GraphData{}, fmt.Errorf("Failed to build the dependency graph: %w", err)
+	}
+	return graphData, nil
+}
+
+// graphOptions completes `opts` with the global flags: the packages listed in
+// the ignore files of the source trees of `state` are left out, unless
+// --no-ignore is set, and base packages are picked by their --base-prefix.
+func graphOptions(state st.State, opts depgraph.Options) (depgraph.Options, error) {
+	opts.BasePrefixes = basePrefixes
+	if !noIgnore {
+		patterns, err := depgraph.IgnorePatterns(state)
+		if err != nil {
+			return opts, err
+		}
+		opts.Ignore = append(opts.Ignore, patterns...)
+	}
+	return opts, nil
+}
+
+// graphIndex maps the nodes of a depgraph.GraphData onto the vertices [0, n) of a
+// yourbasic/graph graph, so that its algorithms can be run on the exported
+// graph. Vertex `i` is `data.Nodes[i]`, and an edge v -> w means that v
+// depends on w.
+type graphIndex struct {
+	data depgraph.GraphData
+	ids  map[string]int
+	g    *graph.Immutable
+}
+
+func newGraphIndex(data depgraph.GraphData) *graphIndex {
+	gi := &graphIndex{
+		data: data,
+		ids:  make(map[string]int, len(data.Nodes)),
+	}
+	for idx, node := range data.Nodes {
+		gi.ids[node.ID] = idx
+	}
+
+	g := graph.New(len(data.Nodes))
+	for _, edge := range data.Edges {
+		g.Add(gi.ids[edge.Source], gi.ids[edge.Target])
+	}
+	gi.g = graph.Sort(g)
+
+	return gi
+}
+
+// names returns the node IDs of the given vertices.
+func (gi *graphIndex) names(vs []int) []string {
+	res := make([]string, len(vs))
+	for idx, v := range vs {
+		res[idx] = gi.data.Nodes[v].ID
+	}
+	return res
+}
+
+// inDegrees returns the number of packages that depend on each vertex.
+func (gi *graphIndex) inDegrees() []int {
+	res := make([]int, gi.g.Order())
+	for v := range res {
+		gi.g.Visit(v, func(w int, _ int64) (skip bool) {
+			res[w]++
+			return
+		})
+	}
+	return res
+}
+
+// reachable returns the vertices that can be reached from any of `starts` in at
+// most `depth` hops, including `starts` themselves. A negative `depth` means
+// that there is no limit. When `reverse` is true, edges are followed
+// backwards, i.e. from a package to its dependents.
+func (gi *graphIndex) reachable(starts []int, depth int, reverse bool) map[int]bool {
+	g := gi.g
+	if reverse {
+		g = graph.Transpose(g)
+	}
+
+	return reachableIn(g, starts, depth)
+}
+
+// neighborhood returns the vertices within `radius` hops of any of `starts`,
+// following the edges in either direction.
+func (gi *graphIndex) neighborhood(starts []int, radius int) map[int]bool {
+	g := graph.New(gi.g.Order())
+	for v := 0; v < gi.g.Order(); v++ {
+		gi.g.Visit(v, func(w int, _ int64) (skip bool) {
+			g.AddBoth(v, w)
+			return
+		})
+	}
+	return reachableIn(graph.Sort(g), starts, radius)
+}
+
+// reachableIn returns the vertices of `g` that are reachable from any of
+// `starts` in at most `depth` hops, or any number of hops if it is negative.
+func reachableIn(g *graph.Immutable, starts []int, depth int) map[int]bool {
+	res := make(map[int]bool)
+	for _, start := range starts {
+		utils.BFSWithDepth(g, start, func(node int, d int) bool {
+			if depth >= 0 && d > depth {
+				return true
+			}
+			res[node] = true
+			return false
+		})
+	}
+	return res
+}
+
+// selfDeps returns, for every source recipe that depends on itself, the
+// sorted build dependencies that resolve back to the same recipe. These never show up
+// as edges in the graph built by buildGraph.
+func selfDeps(state st.State) map[string][]string {
+	res := make(map[string][]string)
+	packages := state.Packages()
+	pvdToPkgIdx := state.PvdToPkgIdx()
+
+	for _, pkg := range packages {
+		for _, dep := range pkg.OwnBuildDeps {
+			if depIdx, found := pvdToPkgIdx[dep]; found && packages[depIdx].Source == pkg.Source {
+				res[pkg.Source] = append(res[pkg.Source], dep)
+			}
+		}
+	}
+	for src, deps := range res {
+		slices.Sort(deps)
+		res[src] = utils.Uniq2(deps)
+	}
+
+	return res
+}
+
+// unresolvedDeps returns, for every source recipe, the sorted build
+// dependencies that don't resolve to any package in the state.
+func unresolvedDeps(state st.State) map[string][]string {
+	res := make(map[string][]string)
+	pvdToPkgIdx := state.PvdToPkgIdx()
+
+	for _, pkg := range state.Packages() {
+		for _, dep := range pkg.BuildDeps {
+			if _, found := pvdToPkgIdx[dep]; !found {
+				res[pkg.Source] = append(res[pkg.Source], dep)
+			}
+		}
+	}
+	for src, deps := range res {
+		slices.Sort(deps)
+		res[src] = utils.Uniq2(deps)
+	}
+
+	return res
+}
+
+// duplicateSources returns, for every source name that is declared by more
+// than one recipe, the sorted paths of those recipes.
+func duplicateSources(state st.State) map[string][]string {
+	paths := make(map[string][]string)
+	for _, pkg := range state.Packages() {
+		paths[pkg.Source] = append(paths[pkg.Source], pkg.Path)
+	}
+
+	res := make(map[string][]string)
+	for src, srcPaths := range paths {
+		slices.Sort(srcPaths)
+		if srcPaths = utils.Uniq2(srcPaths); len(srcPaths) > 1 {
+			res[src] = srcPaths
+		}
+	}
+
+	return res
+}
+
+// unusedProviders returns the sorted providers of the state that no package
+// depends on, either at build time or at runtime.
+func unusedProviders(state st.State) (res []string) {
+	used := make(map[string]bool)
+	for _, pkg := range state.Packages() {
+		for _, dep := range pkg.BuildDeps {
+			used[dep] = true
+		}
+		for _, dep := range pkg.RunDeps {
+			used[dep] = true
+		}
+	}
+
+	for pvd := range state.PvdToPkgIdx() {
+		if !used[pvd] {
+			res = append(res, pvd)
+		}
+	}
+	slices.Sort(res)
+
+	return
+}
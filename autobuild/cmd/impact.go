@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	impactJSON bool
+
+	cmdImpact = &cobra.Command{
+		Use:   "impact [src:path] [package]",
+		Short: "Estimate how many packages have to be rebuilt when a package changes",
+		Long: `Print the number of source recipes that transitively build-depend on the
+given one, i.e. the packages that have to be rebuilt when it changes, along with
+the number of distinct components they belong to.
+
+For example: autobuild impact src:../packages rocm-cmake
+
+The package is selected in the same way as for rdeps, which lists the
+dependents themselves. The number of components is left out if the state
+doesn't record any.`,
+		RunE: runImpact,
+		Args: cobra.ExactArgs(2),
+	}
+)
+
+// impactReport is the output of impact with --json.
+type impactReport struct {
+	Package    string `json:"package"`
+	Dependents int    `json:"dependents"`
+	Components int    `json:"components,omitempty"`
+}
+
+func init() {
+	cmdImpact.Flags().BoolVar(&impactJSON, "json", false, "print the counts as JSON")
+	selectFlagsInit(cmdImpact)
+}
+
+// affectedComponents returns the number of distinct components of the given
+// packages. Split packages count towards every component of their recipe.
+func affectedComponents(gi *graphIndex, names []string) int {
+	seen := make(map[string]bool)
+	for _, name := range names {
+		component := gi.data.Nodes[gi.ids[name]].Component
+		if component == "" {
+			continue
+		}
+		for _, c := range strings.Split(component, ",") {
+			seen[c] = true
+		}
+	}
+	return len(seen)
+}
+
+func runImpact(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	name := args[1]
+	waterlog.SetOutput(os.Stderr)
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	starts, err := selectPackages(gi, []string{name})
+	if err != nil {
+		return err
+	}
+	dependents := closure(gi, starts, -1, true, false)
+	report := impactReport{
+		Package:    name,
+		Dependents: len(dependents),
+		Components: affectedComponents(gi, dependents),
+	}
+
+	if impactJSON {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	fmt.Printf("Dependents: %d\n", report.Dependents)
+	if report.Components > 0 {
+		fmt.Printf("Components: %d\n", report.Components)
+	}
+	return nil
+}
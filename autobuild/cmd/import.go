@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFormat string
+
+	cmdImport = &cobra.Command{
+		Use:   "import [graph.json] [output]",
+		Short: "Convert a graph exported as JSON to another format",
+		Long: `Read a graph previously written by export-json, e.g. after editing it by
+hand, check that it is consistent and export it again in another format,
+without parsing the source recipes again.
+
+For example: autobuild import graph.json --format dot deps.dot
+
+The format is inferred from the extension of the output file as in export,
+unless --format is given. Every edge must connect two packages of the graph:
+dangling edges are reported and the command fails without writing anything.
+The in-degree and out-degree of every package are recomputed from the edges.`,
+		RunE: runImport,
+		Args: cobra.ExactArgs(2),
+	}
+)
+
+func init() {
+	compactFlagInit(cmdImport)
+	cmdImport.Flags().StringVarP(&importFormat, "format", "f", "", "output format, one of json, dot, graphml, gexf, cytoscape, yaml, adjacency, mermaid, jsonl or graphson (default: inferred from the output extension)")
+	cmdImport.Flags().StringVar(&rankdir, "rankdir", "LR", "direction of the graph layout for DOT, one of TB, LR, BT or RL")
+	clusterFlagInit(cmdImport)
+	modeFlagInit(cmdImport)
+}
+
+// loadGraphJSON reads the graph exported as JSON to `path`.
+func loadGraphJSON(path string) (graphData depgraph.GraphData, err error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return graphData, fmt.Errorf("Failed to read graph: %w", err)
+	}
+	if err = json.Unmarshal(raw, &graphData); err != nil {
+		return graphData, fmt.Errorf("Failed to parse graph %s: %w", path, err)
+	}
+	return graphData, nil
+}
+
+// danglingEdges returns the edges of the graph whose source or target is not
+// one of its nodes.
+func danglingEdges(graphData depgraph.GraphData) (res []depgraph.GraphEdge) {
+	ids := make(map[string]bool, len(graphData.Nodes))
+	for _, node := range graphData.Nodes {
+		ids[node.ID] = true
+	}
+	for _, edge := range graphData.Edges {
+		if !ids[edge.Source] || !ids[edge.Target] {
+			res = append(res, edge)
+		}
+	}
+	return
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	inputPath := args[0]
+	outputPath := args[1]
+	redirectLogs(outputPath)
+
+	format, err := detectFormat(importFormat, outputPath)
+	if err != nil {
+		return err
+	}
+	if format == "dot" {
+		if err := checkDOTFlags(); err != nil {
+			return err
+		}
+	}
+
+	graphData, err := loadGraphJSON(inputPath)
+	if err != nil {
+		return err
+	}
+	if graphData.SchemaVersion != depgraph.SchemaVersion {
+		waterlog.Warnf("%s has schema version %d instead of %d, some fields may be missing\n", inputPath, graphData.SchemaVersion, depgraph.SchemaVersion)
+	}
+	waterlog.Goodf("Successfully parsed graph with %d packages and %d dependencies!\n", len(graphData.Nodes), len(graphData.Edges))
+
+	if dangling := danglingEdges(graphData); len(dangling) > 0 {
+		for _, edge := range dangling {
+			waterlog.Errorf("Dangling edge: ")
+			fmt.Fprintf(os.Stderr, "%s -> %s\n", edge.Source, edge.Target)
+		}
+		return fmt.Errorf("Found %d edges whose source or target is not a package of the graph", len(dangling))
+	}
+
+	// Recompute the degrees, which may be stale after editing the edges
+	graphData = graphData.Subgraph(func(depgraph.GraphNode) bool { return true })
+
+	data, err := graphWriters[format]().WriteGraph(graphData)
+	if err != nil {
+		return err
+	}
+	if err = writeOutput(outputPath, data); err != nil {
+		return err
+	}
+	reportExport(graphData, outputPath, len(data))
+	return nil
+}
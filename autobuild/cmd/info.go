@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	infoJSON bool
+
+	cmdInfo = &cobra.Command{
+		Use:   "info [src:path] [package]",
+		Short: "Print the metadata and direct dependencies of a package",
+		Long: `Print the metadata of a source recipe, along with the packages its build and
+runtime dependencies resolve to, its providers and the packages that directly
+build-depend on it.
+
+For example: autobuild info src:../packages rocblas --json
+
+Dependencies are the source recipes they resolve to, without unresolved ones
+and self-dependencies, in the same way as in the graph built by export-json.
+The in- and out-degree are the number of dependents and build dependencies.
+Pass --json to print a single JSON object, e.g. for other tools.`,
+		RunE: runInfo,
+		Args: cobra.ExactArgs(2),
+	}
+)
+
+// packageInfo is the metadata of a package, as printed by info with --json.
+type packageInfo struct {
+	Source     string   `json:"source"`
+	Path       string   `json:"path"`
+	Version    string   `json:"version"`
+	Release    int      `json:"release"`
+	Component  string   `json:"component"`
+	IsBase     bool     `json:"isBase"`
+	Names      []string `json:"names"`
+	BuildDeps  []string `json:"buildDeps"`
+	RunDeps    []string `json:"runDeps"`
+	Provides   []string `json:"provides"`
+	Dependents []string `json:"dependents"`
+	InDegree   int      `json:"inDegree"`
+	OutDegree  int      `json:"outDegree"`
+}
+
+func init() {
+	cmdInfo.Flags().BoolVar(&infoJSON, "json", false, "print the package as a JSON object")
+}
+
+// newPackageInfo collects the metadata of the package at vertex `idx` of the
+// graph, which must have both build and runtime edges.
+func newPackageInfo(state st.State, gi *graphIndex, idx int) packageInfo {
+	node := gi.data.Nodes[idx]
+	pkg := state.Packages()[state.SrcToPkgIds()[node.ID][0]]
+
+	info := packageInfo{
+		Source:     node.ID,
+		Path:       pkg.Path,
+		Version:    node.Version,
+		Release:    node.Release,
+		Component:  node.Component,
+		IsBase:     node.IsBase,
+		Names:      make([]string, 0),
+		BuildDeps:  make([]string, 0),
+		RunDeps:    make([]string, 0),
+		Dependents: make([]string, 0),
+	}
+	for _, id := range state.SrcToPkgIds()[node.ID] {
+		info.Names = append(info.Names, state.Packages()[id].Names...)
+	}
+	info.Provides, _ = packageProviders(state, node.ID)
+	if info.Provides == nil {
+		info.Provides = make([]string, 0)
+	}
+
+	for _, edge := range gi.data.Edges {
+		switch {
+		case edge.Source == node.ID && edge.Kind == depgraph.EdgeBuild:
+			info.BuildDeps = append(info.BuildDeps, edge.Target)
+		case edge.Source == node.ID && edge.Kind == depgraph.EdgeRuntime:
+			info.RunDeps = append(info.RunDeps, edge.Target)
+		case edge.Target == node.ID && edge.Kind == depgraph.EdgeBuild:
+			info.Dependents = append(info.Dependents, edge.Source)
+		}
+	}
+	info.InDegree = len(info.Dependents)
+	info.OutDegree = len(info.BuildDeps)
+
+	return info
+}
+
+func runInfo(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	name := args[1]
+	if infoJSON {
+		waterlog.SetOutput(os.Stderr)
+	}
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.Options{BuildEdges: true, RuntimeEdges: true})
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	idx, err := gi.lookup(name)
+	if err != nil {
+		return err
+	}
+	info := newPackageInfo(state, gi, idx)
+
+	if infoJSON {
+		out, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Source:\t%s\n", info.Source)
+	fmt.Fprintf(w, "Path:\t%s\n", info.Path)
+	fmt.Fprintf(w, "Version:\t%s-%d\n", info.Version, info.Release)
+	fmt.Fprintf(w, "Component:\t%s\n", info.Component)
+	fmt.Fprintf(w, "Base:\t%t\n", info.IsBase)
+	fmt.Fprintf(w, "Packages:\t%s\n", strings.Join(info.Names, " "))
+	fmt.Fprintf(w, "Build deps:\t%s\n", strings.Join(info.BuildDeps, " "))
+	fmt.Fprintf(w, "Runtime deps:\t%s\n", strings.Join(info.RunDeps, " "))
+	fmt.Fprintf(w, "Provides:\t%s\n", strings.Join(info.Provides, " "))
+	fmt.Fprintf(w, "Dependents:\t%s\n", strings.Join(info.Dependents, " "))
+	fmt.Fprintf(w, "Degree:\t%d in, %d out\n", info.InDegree, info.OutDegree)
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listColumns []string
+	listSort    string
+	listJSON    bool
+
+	cmdList = &cobra.Command{
+		Use:   "list [src:path]",
+		Short: "List the packages of a state with selectable columns",
+		Long: `List the source recipes of a state, one per line, with the columns given by
+--columns separated by tabs. Only the source name is printed by default.
+
+For example: autobuild list --columns source,version,numBuildDeps src:../packages
+
+The available columns are source, version, release, component, isBase and
+numBuildDeps, the number of packages the recipe build-depends on. Packages are
+sorted by source name unless --sort names another column. With --json, the
+packages are printed as a JSON array of objects with the selected columns.`,
+		RunE: runList,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+// listColumnValues returns the value of every column of `list` for a node.
+var listColumnValues = map[string]func(depgraph.GraphNode) any{
+	"source":       func(node depgraph.GraphNode) any { return node.ID },
+	"version":      func(node depgraph.GraphNode) any { return node.Version },
+	"release":      func(node depgraph.GraphNode) any { return node.Release },
+	"component":    func(node depgraph.GraphNode) any { return node.Component },
+	"isBase":       func(node depgraph.GraphNode) any { return node.IsBase },
+	"numBuildDeps": func(node depgraph.GraphNode) any { return node.OutDegree },
+}
+
+func init() {
+	cmdList.Flags().StringSliceVar(&listColumns, "columns", []string{"source"}, "comma-separated columns to print")
+	cmdList.Flags().StringVar(&listSort, "sort", "source", "column to sort the packages by")
+	cmdList.Flags().BoolVar(&listJSON, "json", false, "print the packages as JSON")
+}
+
+// compareColumn compares two values of the same column.
+func compareColumn(a any, b any) int {
+	switch a := a.(type) {
+	case int:
+		return cmp.Compare(a, b.(int))
+	case bool:
+		if a == b.(bool) {
+			return 0
+		} else if a {
+			return 1
+		}
+		return -1
+	default:
+		return cmp.Compare(a.(string), b.(string))
+	}
+}
+
+// formatColumn formats a column value for the tabular output.
+func formatColumn(val any) string {
+	switch val := val.(type) {
+	case int:
+		return strconv.Itoa(val)
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		return val.(string)
+	}
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	waterlog.SetOutput(os.Stderr)
+
+	for _, column := range append(listColumns, listSort) {
+		if _, ok := listColumnValues[column]; !ok {
+			return fmt.Errorf("Unknown column %s, must be one of source, version, release, component, isBase, numBuildDeps", column)
+		}
+	}
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	nodes := graphData.Nodes
+	sortBy := listColumnValues[listSort]
+	slices.SortStableFunc(nodes, func(a, b depgraph.GraphNode) int {
+		if c := compareColumn(sortBy(a), sortBy(b)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	if listJSON {
+		rows := make([]map[string]any, 0, len(nodes))
+		for _, node := range nodes {
+			row := make(map[string]any)
+			for _, column := range listColumns {
+				row[column] = listColumnValues[column](node)
+			}
+			rows = append(rows, row)
+		}
+
+		out, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	for _, node := range nodes {
+		fields := make([]string, len(listColumns))
+		for idx, column := range listColumns {
+			fields[idx] = formatColumn(listColumnValues[column](node))
+		}
+		fmt.Println(strings.Join(fields, "\t"))
+	}
+	return nil
+}
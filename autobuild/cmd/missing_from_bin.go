@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/DataDrake/waterlog"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	missingFromBinJSON bool
+
+	cmdMissingFromBin = &cobra.Command{
+		Use:   "missing-from-bin [src:path] [bin:path]",
+		Short: "List the source recipes that still have to be published to a binary index",
+		Long: `List the source recipes that are missing from the binary index, grouped into
+the ones that have never been built and the ones whose binary packages are
+outdated, i.e. have a lower release number than the recipe.
+
+For example: autobuild missing-from-bin src:../packages repo:unstable
+
+Recipes are compared by their source name, in the same way as diff compares
+the binary index against the source tree.`,
+		RunE: runMissingFromBin,
+		Args: cobra.ExactArgs(2),
+	}
+)
+
+// missingFromBinReport is the output of missing-from-bin with --json.
+type missingFromBinReport struct {
+	NeverBuilt []string        `json:"neverBuilt"`
+	Outdated   []versionChange `json:"outdated"`
+}
+
+func init() {
+	cmdMissingFromBin.Flags().BoolVar(&missingFromBinJSON, "json", false, "print the packages as JSON")
+}
+
+func runMissingFromBin(cmd *cobra.Command, args []string) error {
+	srcTPath := args[0]
+	binTPath := args[1]
+	waterlog.SetOutput(os.Stderr)
+
+	srcState, err := st.LoadState(cmd.Context(), srcTPath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to load source state %s: %w", srcTPath, err)
+	}
+	waterlog.Goodln("Successfully parsed source state!")
+
+	binState, err := st.LoadState(cmd.Context(), binTPath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to load binary state %s: %w", binTPath, err)
+	}
+	waterlog.Goodln("Successfully parsed binary state!")
+
+	diff := diffStates(binState, srcState)
+	report := missingFromBinReport{
+		NeverBuilt: diff.Added,
+		Outdated:   diff.Updated,
+	}
+	if report.NeverBuilt == nil {
+		report.NeverBuilt = make([]string, 0)
+	}
+	if report.Outdated == nil {
+		report.Outdated = make([]versionChange, 0)
+	}
+
+	if missingFromBinJSON {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	if len(report.NeverBuilt) > 0 {
+		fmt.Println("Never built:")
+		for _, src := range report.NeverBuilt {
+			fmt.Printf("  %s\n", src)
+		}
+	}
+	if len(report.Outdated) > 0 {
+		fmt.Println("Outdated:")
+		for _, c := range report.Outdated {
+			fmt.Printf("  %s: %s-%d -> %s-%d\n", c.Source, c.OldVersion, c.OldRelease, c.Version, c.Release)
+		}
+	}
+	waterlog.Infof("%d never built and %d outdated packages\n", len(report.NeverBuilt), len(report.Outdated))
+	return nil
+}
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	orphansNoDeps       bool
+	orphansNoDependents bool
+	orphansIncludeBase  bool
+
+	cmdOrphans = &cobra.Command{
+		Use:   "orphans [src:path]",
+		Short: "List packages that are disconnected from the dependency graph",
+		Long: `List the source recipes that neither build-depend on any other package nor
+are build-depended on by any, one per line. These are candidates for a removal
+review.
+
+For example: autobuild orphans src:../packages
+
+Use --no-deps to list the packages without build dependencies, regardless of
+their dependents, and --no-dependents to list the packages that nothing
+build-depends on, regardless of their dependencies. Base packages are skipped
+unless --include-base is passed.`,
+		RunE: runOrphans,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+func init() {
+	cmdOrphans.Flags().BoolVar(&orphansNoDeps, "no-deps", false, "list the packages without build dependencies")
+	cmdOrphans.Flags().BoolVar(&orphansNoDependents, "no-dependents", false, "list the packages that no package depends on")
+	cmdOrphans.Flags().BoolVar(&orphansIncludeBase, "include-base", false, "also list base packages")
+}
+
+// orphans returns the names of the packages that have no dependencies if
+// `noDeps` is set and no dependents if `noDependents` is set.
+func orphans(gi *graphIndex, noDeps bool, noDependents bool, includeBase bool) (res []string) {
+	inDegrees := gi.inDegrees()
+	for v, node := range gi.data.Nodes {
+		if node.IsBase && !includeBase {
+			continue
+		}
+		if noDeps && gi.g.Degree(v) > 0 {
+			continue
+		}
+		if noDependents && inDegrees[v] > 0 {
+			continue
+		}
+		res = append(res, node.ID)
+	}
+	return
+}
+
+func runOrphans(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	waterlog.SetOutput(os.Stderr)
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	// Without either flag, both conditions have to hold
+	noDeps, noDependents := orphansNoDeps, orphansNoDependents
+	if !noDeps && !noDependents {
+		noDeps, noDependents = true, true
+	}
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	for _, name := range orphans(gi, noDeps, noDependents, orphansIncludeBase) {
+		fmt.Println(name)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+	"github.com/yourbasic/graph"
+)
+
+var cmdPathToBase = &cobra.Command{
+	Use:   "path-to-base [src:path] [package]",
+	Short: "Explain why a package build-depends on the base system",
+	Long: `Print a shortest build dependency path from a source recipe to any base
+package, i.e. a package in system.base or system.devel unless --base-prefix
+says otherwise, in the same format as why.
+
+For example: autobuild path-to-base src:../packages nano
+
+When several base packages are equally close, the one that comes first by name
+is picked. Exits with a non-zero status if the package doesn't depend on any
+base package.`,
+	RunE: runPathToBase,
+	Args: cobra.ExactArgs(2),
+}
+
+// closestMatch returns the vertex closest to `from` that isn't `from` and for
+// which `match` returns true, preferring lower vertices among equally close
+// ones, or -1 if no such vertex is reachable.
+func closestMatch(g graph.Iterator, from int, match func(int) bool) int {
+	_, dist := graph.ShortestPaths(g, from)
+	closest := -1
+	for v, d := range dist {
+		if v == from || d < 0 || !match(v) {
+			continue
+		}
+		if closest < 0 || d < dist[closest] {
+			closest = v
+		}
+	}
+	return closest
+}
+
+func runPathToBase(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	name := args[1]
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	from, err := gi.lookup(name)
+	if err != nil {
+		return err
+	}
+	if gi.data.Nodes[from].IsBase {
+		waterlog.Infof("%s is a base package itself\n", name)
+	}
+
+	to := closestMatch(gi.g, from, func(v int) bool { return gi.data.Nodes[v].IsBase })
+	if to < 0 {
+		return fmt.Errorf("%s does not depend on any base package", name)
+	}
+
+	path, _ := graph.ShortestPath(gi.g, from, to)
+	printPath(state, gi, path)
+	return nil
+}
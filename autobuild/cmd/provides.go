@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/DataDrake/waterlog"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	providesRegex   bool
+	providesReverse bool
+
+	cmdProvides = &cobra.Command{
+		Use:   "provides [src:path] [provider]",
+		Short: "Print the packages that provide a library or other provider",
+		Long: `Print the source recipe that the given provider, e.g. a pkgconfig() name or a
+subpackage, resolves to when it is used as a dependency.
+
+For example: autobuild provides src:../packages "pkgconfig(zlib)"
+
+If more than one recipe declares the provider, the others are listed after the
+one it resolves to. With --regex, the argument is a regular expression and
+every provider that matches it is printed.
+
+With --reverse, the argument is a package instead, either a source recipe or
+one of its subpackages, and every provider it declares is printed.`,
+		RunE: runProvides,
+		Args: cobra.ExactArgs(2),
+	}
+)
+
+func init() {
+	cmdProvides.Flags().BoolVar(&providesRegex, "regex", false, "match the provider as a regular expression")
+	cmdProvides.Flags().BoolVarP(&providesReverse, "reverse", "r", false, "print the providers of the given package instead")
+}
+
+// matchProviders returns the sorted providers of `state` that are `pattern`,
+// or that match it as a regular expression if `regex` is set.
+func matchProviders(state st.State, pattern string, regex bool) ([]string, error) {
+	if !regex {
+		if _, found := state.PvdToPkgIds()[pattern]; found {
+			return []string{pattern}, nil
+		}
+		return nil, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid regular expression %s: %w", pattern, err)
+	}
+	var res []string
+	for pvd := range state.PvdToPkgIds() {
+		if re.MatchString(pvd) {
+			res = append(res, pvd)
+		}
+	}
+	slices.Sort(res)
+	return res, nil
+}
+
+// packageProviders returns the sorted providers declared by the source recipe
+// or subpackage `name`, and whether it exists at all. Subpackages that are
+// not listed in the names of their package are found through the provider of
+// the same name.
+func packageProviders(state st.State, name string) (res []string, found bool) {
+	for _, pkg := range state.Packages() {
+		if pkg.Source == name || slices.Contains(pkg.Names, name) {
+			found = true
+			res = append(res, pkg.Provides...)
+		}
+	}
+	if idx, ok := state.PvdToPkgIdx()[name]; !found && ok {
+		found = true
+		res = append(res, state.Packages()[idx].Provides...)
+	}
+	slices.Sort(res)
+	return slices.Compact(res), found
+}
+
+func runProvides(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	name := args[1]
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	if providesReverse {
+		pvds, found := packageProviders(state, name)
+		if !found {
+			var names []string
+			for _, pkg := range state.Packages() {
+				names = append(names, pkg.Names...)
+			}
+			if suggestions := didYouMean(name, names); len(suggestions) > 0 {
+				return fmt.Errorf("Unable to find package %s, did you mean %s?", name, strings.Join(suggestions, ", "))
+			}
+			return fmt.Errorf("Unable to find package %s", name)
+		}
+		for _, pvd := range pvds {
+			fmt.Println(pvd)
+		}
+		return nil
+	}
+
+	pvds, err := matchProviders(state, name, providesRegex)
+	if err != nil {
+		return err
+	}
+	if len(pvds) == 0 {
+		if !providesRegex {
+			candidates := make([]string, 0, len(state.PvdToPkgIds()))
+			for pvd := range state.PvdToPkgIds() {
+				candidates = append(candidates, pvd)
+			}
+			if suggestions := didYouMean(name, candidates); len(suggestions) > 0 {
+				return fmt.Errorf("No package provides %s, did you mean %s?", name, strings.Join(suggestions, ", "))
+			}
+		}
+		return fmt.Errorf("No package provides %s", name)
+	}
+
+	packages := state.Packages()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, pvd := range pvds {
+		resolved := state.PvdToPkgIdx()[pvd]
+		var others []string
+		for _, idx := range state.PvdToPkgIds()[pvd] {
+			if idx != resolved {
+				others = append(others, packages[idx].Source)
+			}
+		}
+
+		if len(others) > 0 {
+			fmt.Fprintf(w, "%s\t%s\t(also declared by %s)\n", pvd, packages[resolved].Source, strings.Join(others, ", "))
+		} else {
+			fmt.Fprintf(w, "%s\t%s\n", pvd, packages[resolved].Source)
+		}
+	}
+	w.Flush()
+	return nil
+}
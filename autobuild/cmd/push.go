@@ -5,6 +5,8 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/DataDrake/waterlog"
 	"github.com/GZGavinZhao/autobuild/common"
 	"github.com/GZGavinZhao/autobuild/state"
@@ -24,7 +26,7 @@ push the packages that are passed.
 If you get a cycles output, query the build order of those packages with 
 autobuild query to get a more detailed output on the cycle.
 `,
-		Run: runPush,
+		RunE: runPush,
 	}
 )
 
@@ -34,21 +36,21 @@ func init() {
 	cmdPush.Flags().BoolP("push", "p", true, "git push packages before publishing")
 }
 
-func runPush(cmd *cobra.Command, args []string) {
+func runPush(cmd *cobra.Command, args []string) error {
 	oldTPath := args[0]
 	newTPath := args[1]
 
 	var oldState, newState state.State
 
-	oldState, err := state.LoadState(oldTPath)
+	oldState, err := state.LoadState(cmd.Context(), oldTPath, loadJobs)
 	if err != nil {
-		waterlog.Fatalf("Failed to load old state %s: %s\n", oldTPath, err)
+		return fmt.Errorf("Failed to load old state %s: %w", oldTPath, err)
 	}
 	waterlog.Goodln("Successfully parsed old state!")
 
-	newState, err = state.LoadState(newTPath)
+	newState, err = state.LoadState(cmd.Context(), newTPath, loadJobs)
 	if err != nil {
-		waterlog.Fatalf("Failed to load new state %s: %s\n", newTPath, err)
+		return fmt.Errorf("Failed to load new state %s: %w", newTPath, err)
 	}
 	waterlog.Goodln("Successfully parsed new state!")
 
@@ -63,12 +65,12 @@ func runPush(cmd *cobra.Command, args []string) {
 		for _, name := range args[2:] {
 			oldPkg, oldIdx := state.GetPackage(oldState, name)
 			if oldIdx == -1 {
-				waterlog.Fatalf("Cannot find %s in old state!\n", name)
+				return fmt.Errorf("Cannot find %s in old state!", name)
 			}
 
 			newPkg, newIdx := state.GetPackage(newState, name)
 			if newIdx == -1 {
-				waterlog.Fatalf("Cannot find %s in old state!\n", name)
+				return fmt.Errorf("Cannot find %s in old state!", name)
 			}
 
 			changes = append(changes, state.Diff{
@@ -257,4 +259,5 @@ func runPush(cmd *cobra.Command, args []string) {
 	//		os.Exit(1)
 	//	}
 	//}
+	return nil
 }
@@ -36,7 +36,7 @@ want to query specific packages, use the provider syntax, such as "name(foo)".
 
 When no arguments are passed, it tries to compute a build order of all the
 packages it can find.`,
-		Run: runQuery,
+		RunE: runQuery,
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 1 {
 				return errors.New("expects one arg for path to binary index or source repo")
@@ -124,12 +124,12 @@ func execQuery(state st.State, queries []string) (res [][]common.Package, err er
 	return st.QueryOrder(state, func(i int) bool { return qset[i] })
 }
 
-func runQuery(cmd *cobra.Command, args []string) {
+func runQuery(cmd *cobra.Command, args []string) error {
 	tpath := args[0]
 
-	state, err := st.LoadState(tpath)
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
 	if err != nil {
-		waterlog.Fatalf("Failed to parse state: %s\n", err)
+		return fmt.Errorf("Failed to parse state: %w", err)
 	}
 	waterlog.Goodln("Successfully parsed state!")
 
@@ -163,7 +163,7 @@ func runQuery(cmd *cobra.Command, args []string) {
 				fmt.Println(cycle.Chain[0].Show(showSub, true))
 			}
 		}
-		waterlog.Fatalf("Failed to query order: %s\n", err)
+		return fmt.Errorf("Failed to query order: %w", err)
 	}
 
 	if tiers {
@@ -181,4 +181,5 @@ func runQuery(cmd *cobra.Command, args []string) {
 		}
 		fmt.Println()
 	}
+	return nil
 }
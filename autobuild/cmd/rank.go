@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// pageRankIterations and pageRankTolerance bound the PageRank iteration,
+	// which stops once the scores change by less than the tolerance in total.
+	pageRankIterations = 100
+	pageRankTolerance  = 1e-9
+)
+
+var (
+	rankTop     int
+	rankDamping float64
+	rankJSON    bool
+
+	cmdRank = &cobra.Command{
+		Use:   "rank [src:path]",
+		Short: "List packages by PageRank over the build dependency graph",
+		Long: `Rank the source recipes by their PageRank over the build dependency graph,
+highest first. A package ranks high when many packages depend on it, and even
+higher when the packages that depend on it rank high themselves, so that it
+surfaces the packages the whole repository rests on rather than those with the
+most direct dependents.
+
+For example: autobuild rank src:../packages --top 20
+
+Every package passes its score on to its build dependencies, shared equally
+among them, and packages without any build dependency share theirs with every
+package. --damping is the share of the score that follows dependencies, the rest
+being spread evenly. The scores add up to 1. The iteration stops once the scores
+change by less than 1e-9 in total, or after 100 iterations.`,
+		RunE: runRank,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+type rankStat struct {
+	Package string  `json:"package"`
+	Score   float64 `json:"score"`
+}
+
+func init() {
+	cmdRank.Flags().IntVar(&rankTop, "top", 0, "only list the N highest ranked packages, all of them if not positive")
+	cmdRank.Flags().Float64Var(&rankDamping, "damping", 0.85, "probability of following a dependency rather than jumping to a random package, between 0 and 1")
+	cmdRank.Flags().BoolVar(&rankJSON, "json", false, "print the ranking as JSON")
+}
+
+// pageRank returns the PageRank of every vertex of the graph, where an edge
+// v -> w passes score from v to w, and whether it converged.
+func pageRank(gi *graphIndex, damping float64) (scores []float64, converged bool) {
+	n := len(gi.data.Nodes)
+	if n == 0 {
+		return nil, true
+	}
+
+	scores = make([]float64, n)
+	for v := range scores {
+		scores[v] = 1 / float64(n)
+	}
+
+	next := make([]float64, n)
+	for iteration := 0; iteration < pageRankIterations; iteration++ {
+		// The score of packages without dependencies is spread evenly
+		dangling := 0.0
+		for v := range scores {
+			if gi.g.Degree(v) == 0 {
+				dangling += scores[v]
+			}
+		}
+
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		for v := range next {
+			next[v] = base
+		}
+		for v := range scores {
+			if degree := gi.g.Degree(v); degree > 0 {
+				share := damping * scores[v] / float64(degree)
+				gi.g.Visit(v, func(w int, _ int64) bool {
+					next[w] += share
+					return false
+				})
+			}
+		}
+
+		delta := 0.0
+		for v := range scores {
+			delta += math.Abs(next[v] - scores[v])
+		}
+		scores, next = next, scores
+		if delta < pageRankTolerance {
+			return scores, true
+		}
+	}
+	return scores, false
+}
+
+func runRank(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	if rankJSON {
+		waterlog.SetOutput(os.Stderr)
+	}
+	if rankDamping < 0 || rankDamping > 1 {
+		return fmt.Errorf("Invalid --damping %g, must be between 0 and 1", rankDamping)
+	}
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	scores, converged := pageRank(gi, rankDamping)
+	if !converged {
+		waterlog.Warnf("PageRank did not converge after %d iterations\n", pageRankIterations)
+	}
+
+	ranking := make([]rankStat, len(scores))
+	for v, score := range scores {
+		ranking[v] = rankStat{Package: gi.data.Nodes[v].ID, Score: score}
+	}
+	// Highest score first, alphabetically on ties
+	slices.SortStableFunc(ranking, func(a, b rankStat) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Package, b.Package)
+	})
+	if rankTop > 0 {
+		ranking = ranking[:min(rankTop, len(ranking))]
+	}
+
+	if rankJSON {
+		out, err := json.MarshalIndent(ranking, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for idx, stat := range ranking {
+		fmt.Fprintf(w, "%d\t%s\t%.6f\n", idx+1, stat.Package, stat.Score)
+	}
+	w.Flush()
+	return nil
+}
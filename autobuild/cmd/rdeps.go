@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rdepsDirect bool
+	rdepsJSON   bool
+
+	cmdRdeps = &cobra.Command{
+		Use:   "rdeps [src:path] [package]",
+		Short: "List the packages that transitively build-depend on a package",
+		Long: `List every source recipe that transitively build-depends on the given one,
+i.e. the packages that have to be rebuilt when it changes, one per line.
+
+For example: autobuild rdeps src:../packages rocm-cmake
+
+The package can be given as a shell-style glob such as "python-*", or as a
+regular expression with --regex, in which case the packages that depend on any
+of the matching ones are listed. This is the inverse of the closure command.
+
+Pass "-" as the package to read the packages from stdin, one per line, e.g.:
+
+  git diff --name-only HEAD~ | cut -d/ -f2 | sort -u | autobuild rdeps src:. -`,
+		RunE: runRdeps,
+		Args: cobra.ExactArgs(2),
+	}
+)
+
+// rdepsReport is the output of rdeps with --json.
+type rdepsReport struct {
+	Package    string   `json:"package"`
+	Dependents []string `json:"dependents"`
+}
+
+func init() {
+	cmdRdeps.Flags().BoolVar(&rdepsDirect, "direct", false, "only list the packages that directly depend on the package")
+	cmdRdeps.Flags().BoolVar(&rdepsJSON, "json", false, "print the packages as JSON")
+	selectFlagsInit(cmdRdeps)
+}
+
+func runRdeps(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	name := args[1]
+	waterlog.SetOutput(os.Stderr)
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	starts, err := selectPackages(gi, []string{name})
+	if err != nil {
+		return err
+	}
+
+	depth := -1
+	if rdepsDirect {
+		depth = 1
+	}
+	dependents := closure(gi, starts, depth, true, false)
+
+	if rdepsJSON {
+		out, err := json.MarshalIndent(rdepsReport{Package: name, Dependents: dependents}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	for _, dependent := range dependents {
+		fmt.Println(dependent)
+	}
+	return nil
+}
@@ -5,10 +5,20 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
 	"runtime/debug"
+	"syscall"
+	"time"
 
 	"github.com/DataDrake/waterlog"
 	"github.com/DataDrake/waterlog/format"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/GZGavinZhao/autobuild/ypkg"
 	"github.com/spf13/cobra"
 )
 
@@ -24,10 +34,17 @@ var (
 		return ""
 	}()
 
+	// cancelRun cancels the context of the running command, see Execute.
+	cancelRun context.CancelCauseFunc
+
 	rootCmd = &cobra.Command{
 		Use:   "autobuild",
 		Short: "Automatically query, build, and push packages elegantly.",
-		PersistentPreRun: func(_ *cobra.Command, _ []string) {
+		PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+			// The arguments are valid by now, so the errors of the command
+			// are not usage ones, and Execute logs them instead of Cobra
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
 			waterlog.SetFormat(format.Min)
 			if quiet {
 				waterlog.SetLevel(0)
@@ -36,6 +53,15 @@ var (
 			} else {
 				waterlog.SetLevel(6)
 			}
+			ypkg.CacheEnabled = !noCache
+			utils.ProgressEnabled = !quiet
+			utils.ProfilingEnabled = profilePath != ""
+			if timeout > 0 {
+				time.AfterFunc(timeout, func() {
+					waterlog.Warnf("Timed out after %s, stopping\n", timeout)
+					cancelRun(fmt.Errorf("Timed out after %s", timeout))
+				})
+			}
 		},
 		Version: "0.0.0+" + GitCommit,
 	}
@@ -44,17 +70,111 @@ var (
 func init() {
 	rootCmd.AddCommand(cmdQuery)
 	rootCmd.AddCommand(cmdDiff)
+	rootCmd.AddCommand(cmdMissingFromBin)
 	rootCmd.AddCommand(cmdPush)
+	rootCmd.AddCommand(cmdExport)
+	rootCmd.AddCommand(cmdImport)
 	rootCmd.AddCommand(cmdExportJSON)
+	rootCmd.AddCommand(cmdExportDOT)
+	rootCmd.AddCommand(cmdExportCytoscape)
+	rootCmd.AddCommand(cmdExportGEXF)
+	rootCmd.AddCommand(cmdExportGraphML)
+	rootCmd.AddCommand(cmdExportCSV)
+	rootCmd.AddCommand(cmdCycles)
+	rootCmd.AddCommand(cmdBootstrapSeed)
+	rootCmd.AddCommand(cmdBuildOrder)
+	rootCmd.AddCommand(cmdBumpOrder)
+	rootCmd.AddCommand(cmdChangedClosure)
+	rootCmd.AddCommand(cmdVerifyOrder)
+	rootCmd.AddCommand(cmdWaves)
+	rootCmd.AddCommand(cmdSubgraph)
+	rootCmd.AddCommand(cmdClosure)
+	rootCmd.AddCommand(cmdRdeps)
+	rootCmd.AddCommand(cmdImpact)
+	rootCmd.AddCommand(cmdWhy)
+	rootCmd.AddCommand(cmdProvides)
+	rootCmd.AddCommand(cmdInfo)
+	rootCmd.AddCommand(cmdTree)
+	rootCmd.AddCommand(cmdPathToBase)
+	rootCmd.AddCommand(cmdOrphans)
+	rootCmd.AddCommand(cmdList)
+	rootCmd.AddCommand(cmdCheckDeps)
+	rootCmd.AddCommand(cmdCheckDupes)
+	rootCmd.AddCommand(cmdCheckSelfDeps)
+	rootCmd.AddCommand(cmdCheckFanout)
+	rootCmd.AddCommand(cmdCheckProviders)
+	rootCmd.AddCommand(cmdValidateYml)
+	rootCmd.AddCommand(cmdValidateJSON)
+	rootCmd.AddCommand(cmdStats)
+	rootCmd.AddCommand(cmdRank)
+	rootCmd.AddCommand(cmdComponents)
+	rootCmd.AddCommand(cmdCache)
+	rootCmd.AddCommand(cmdServe)
 
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "quiet output")
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "don't read or write the cache of parsed package.yml files")
+	rootCmd.PersistentFlags().BoolVar(&noIgnore, "no-ignore", false, "don't leave out the packages listed in the .depgraphignore file of source trees")
+	rootCmd.PersistentFlags().StringArrayVar(&basePrefixes, "base-prefix", depgraph.DefaultBasePrefixes, "treat the packages whose component starts with `PREFIX`, ignoring case, as base packages; may be repeated")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "abort loading and exporting after this long, e.g. 10m (default: no timeout)")
+	rootCmd.PersistentFlags().IntVar(&loadJobs, "load-jobs", 0, "number of recipe directories to parse concurrently when loading a source tree (default: based on the number of CPUs)")
+	rootCmd.PersistentFlags().StringVar(&profilePath, "profile", "", "write a pprof memory profile to `PATH` and log the time spent loading, parsing and writing, along with the peak number of packages and dependencies")
 	rootCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
 }
 
-func Execute() {
-	rootCmd.Execute()
-	// if err := rootCmd.Execute(); err != nil {
-	// 	waterlog.Fatalf("autobuild failed: %s\n", err)
-	// }
+// exitStatus is returned by the commands that exit with a status other than 1
+// after reporting why themselves, e.g. exitCycles.
+type exitStatus int
+
+func (status exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(status))
+}
+
+// writeProfile writes the memory profile and the phase timings to --profile,
+// if it is set.
+func writeProfile() {
+	if profilePath == "" {
+		return
+	}
+	if err := utils.ReportProfile(profilePath); err != nil {
+		waterlog.Errorf("%s\n", err)
+		return
+	}
+	waterlog.Goodf("Wrote memory profile to %s\n", profilePath)
+}
+
+// Execute runs the command given on the command line and returns its exit
+// status. Its context is cancelled on SIGINT or SIGTERM, or after --timeout,
+// so that loading states and building graphs stop early. A second signal kills
+// the process right away.
+//
+// Commands report failures by returning an error rather than exiting, so that
+// the profile is written even then.
+func Execute() int {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	cancelRun = cancel
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		waterlog.Warnln("Interrupted, stopping")
+		cancel(errors.New("Interrupted"))
+	}()
+
+	defer writeProfile()
+	cmd, err := rootCmd.ExecuteContextC(ctx)
+	if err == nil {
+		return 0
+	}
+	var status exitStatus
+	if errors.As(err, &status) {
+		return int(status)
+	}
+	if cmd.SilenceErrors {
+		waterlog.Errorf("%s\n", err)
+	}
+	return 1
 }
@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/spf13/cobra"
+)
+
+// stdinPath is the package argument that makes selectPackages read the
+// packages from stdin.
+const stdinPath = "-"
+
+var (
+	selectRegex  bool
+	selectStrict bool
+)
+
+// selectFlagsInit registers the flags that control how the package arguments
+// of `cmd` are matched by selectPackages.
+func selectFlagsInit(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&selectRegex, "regex", false, "treat the package arguments as regular expressions matched against source names")
+	cmd.Flags().BoolVar(&selectStrict, "strict", false, "fail if a package argument doesn't match any package")
+}
+
+// matchPackages returns the vertices whose source name matches `pattern`,
+// which is a regular expression if `regex` is set, a shell-style glob if it
+// contains any of "*?[", or an exact name otherwise.
+func matchPackages(gi *graphIndex, pattern string, regex bool) (res []int, err error) {
+	var match func(string) bool
+	if regex {
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("Invalid regular expression %s: %w", pattern, err)
+		}
+		match = re.MatchString
+	} else if strings.ContainsAny(pattern, "*?[") {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid glob %s: %w", pattern, err)
+		}
+		match = func(name string) bool {
+			matched, _ := path.Match(pattern, name)
+			return matched
+		}
+	} else if idx, found := gi.ids[pattern]; found {
+		return []int{idx}, nil
+	} else {
+		return nil, nil
+	}
+
+	for v, node := range gi.data.Nodes {
+		if match(node.ID) {
+			res = append(res, v)
+		}
+	}
+	return
+}
+
+// readPatterns replaces every "-" in the package arguments with the lines read
+// from stdin, skipping empty lines.
+func readPatterns(args []string, stdin io.Reader) (res []string, err error) {
+	for _, arg := range args {
+		if arg != stdinPath {
+			res = append(res, arg)
+			continue
+		}
+
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				res = append(res, line)
+			}
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, fmt.Errorf("Failed to read packages from stdin: %w", err)
+		}
+	}
+	return
+}
+
+// selectPackages expands the package arguments into the sorted vertices of
+// all the packages they match, according to the flags registered by
+// selectFlagsInit. A "-" argument is replaced by the packages read from stdin,
+// one per line. Arguments that don't match anything are warned about, unless
+// --strict is set, in which case they are an error.
+func selectPackages(gi *graphIndex, args []string) (res []int, err error) {
+	patterns, err := readPatterns(args, os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range patterns {
+		matched, err := matchPackages(gi, pattern, selectRegex)
+		if err != nil {
+			return nil, err
+		}
+		if len(matched) == 0 {
+			// Only exact names can be misspelled ones
+			if !selectRegex && !strings.ContainsAny(pattern, "*?[") {
+				err = unknownPackage(gi, pattern)
+			} else {
+				err = fmt.Errorf("No package matches %s", pattern)
+			}
+			if selectStrict {
+				return nil, err
+			}
+			waterlog.Warnf("%s\n", err)
+		}
+		res = append(res, matched...)
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("No package matches %s", strings.Join(patterns, " "))
+	}
+	slices.Sort(res)
+	return slices.Compact(res), nil
+}
@@ -0,0 +1,249 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveAddr     string
+	serveWatch    bool
+	watchDebounce time.Duration
+
+	cmdServe = &cobra.Command{
+		Use:   "serve [src:path...]",
+		Short: "Serve the dependency graph as JSON over HTTP",
+		Long: `Load the state once and serve its dependency graph, in the same JSON format
+as export-json, so that the depgraph web visualization can fetch it directly.
+
+For example: autobuild serve src:../packages2 --addr :8080
+
+The following endpoints are available:
+
+  /graph.json  the dependency graph. Pass ?exclude-base=1 to drop base
+               packages and ?root=PKG to only keep the transitive build
+               dependencies of PKG.
+  /reload      load the state again and rebuild the graph.
+  /events      with --watch, a stream of Server-Sent Events with an "update"
+               event every time the graph has been rebuilt.
+
+With --watch, the source tpaths are watched for changes to the files of their
+recipes, e.g. with inotify on Linux. Once no file has changed for
+--watch-debounce, the changed recipes are parsed again and only
+the dependencies of those and of their dependents are resolved again, the rest
+of the graph being reused. When several tpaths are given, recipes of later
+ones still override those of earlier ones. The "update" events list the
+changed packages and their dependents, so clients can refetch /graph.json.`,
+		RunE: runServe,
+		Args: cobra.MinimumNArgs(1),
+	}
+)
+
+func init() {
+	exportFlagsInit(cmdServe)
+	compactFlagInit(cmdServe)
+	cmdServe.Flags().StringVar(&serveAddr, "addr", ":8080", "address to listen on")
+	cmdServe.Flags().BoolVar(&serveWatch, "watch", false, "rebuild the graph whenever a package.yml changes")
+	cmdServe.Flags().DurationVar(&watchDebounce, "watch-debounce", 500*time.Millisecond, "how long to wait for files to stop changing before updating the graph with --watch")
+}
+
+// graphServer serves the graph of the states at `tpaths`, merged into one,
+// which can be reloaded while the server is running.
+type graphServer struct {
+	tpaths []string
+	opts   depgraph.Options
+	// Whether the graph is updated with --watch.
+	watching bool
+
+	// buildMutex ensures that only one goroutine rebuilds the graph at a
+	// time, while mutex protects the fields below.
+	buildMutex sync.Mutex
+	mutex      sync.RWMutex
+	graphData  depgraph.GraphData
+	// The graph before the filters of opts and the state of every tpath,
+	// kept around to update them with --watch.
+	raw     depgraph.GraphData
+	sources []*st.SourceState
+
+	events *eventHub
+}
+
+// load loads the state and replaces the served graph with its graph, unless
+// `ctx` is cancelled first.
+func (s *graphServer) load(ctx context.Context) error {
+	s.buildMutex.Lock()
+	defer s.buildMutex.Unlock()
+
+	var state st.State
+	var sources []*st.SourceState
+	if s.watching {
+		for _, tpath := range s.tpaths {
+			source, err := st.LoadState(ctx, tpath, loadJobs)
+			if err != nil {
+				return fmt.Errorf("Failed to parse state: %w", err)
+			}
+			sources = append(sources, source.(*st.SourceState))
+		}
+		state = mergeSources(sources)
+	} else {
+		var err error
+		if state, err = st.LoadStates(ctx, s.tpaths, loadJobs); err != nil {
+			return fmt.Errorf("Failed to parse state: %w", err)
+		}
+	}
+	opts, err := graphOptions(state, s.opts)
+	if err != nil {
+		return err
+	}
+	raw, err := depgraph.Build(ctx, state, opts.Unfiltered())
+	if err != nil {
+		return fmt.Errorf("Failed to build the dependency graph: %w", err)
+	}
+	graphData := raw.Filter(opts)
+
+	s.mutex.Lock()
+	s.graphData, s.raw, s.sources = graphData, raw, sources
+	s.mutex.Unlock()
+
+	waterlog.Goodf("Loaded graph with %d packages and %d dependencies\n", len(graphData.Nodes), len(graphData.Edges))
+	return nil
+}
+
+func (s *graphServer) handleGraph(w http.ResponseWriter, r *http.Request) {
+	s.mutex.RLock()
+	graphData := s.graphData
+	s.mutex.RUnlock()
+
+	if root := r.URL.Query().Get("root"); root != "" {
+		gi := newGraphIndex(graphData)
+		idx, err := gi.lookup(root)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err)
+			return
+		}
+		keep := gi.reachable([]int{idx}, -1, false)
+		graphData = graphData.Subgraph(func(node depgraph.GraphNode) bool { return keep[gi.ids[node.ID]] })
+	}
+	if excludeBase || queryFlag(r, "exclude-base") {
+		graphData = graphData.Subgraph(func(node depgraph.GraphNode) bool { return !node.IsBase })
+	}
+	if len(components) > 0 {
+		graphData = graphData.Subgraph(func(node depgraph.GraphNode) bool { return depgraph.InComponents(node, components) })
+	}
+
+	data, err := jsonWriter{compact: compactJSON}.WriteGraph(graphData)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (s *graphServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	// Finish reloading even if the client goes away, rather than leaving the
+	// previous graph in place
+	if err := s.load(context.WithoutCancel(r.Context())); err != nil {
+		waterlog.Errorf("%s\n", err)
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.mutex.RLock()
+	summary := map[string]int{"nodes": len(s.graphData.Nodes), "edges": len(s.graphData.Edges)}
+	s.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// queryFlag reports whether the boolean query parameter `name` is set.
+func queryFlag(r *http.Request, name string) bool {
+	switch r.URL.Query().Get(name) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// writeJSONError responds with `status` and `err` as a JSON object.
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	// The base packages and components are filtered on every request
+	// instead, after ?root= has been applied.
+	opts, err := exportOptions()
+	if err != nil {
+		return err
+	}
+	opts.ExcludeBase, opts.Components = false, nil
+
+	if serveWatch {
+		for _, tpath := range args {
+			if !strings.HasPrefix(tpath, "src:") {
+				return fmt.Errorf("--watch only supports source tpaths, got %s", tpath)
+			}
+		}
+	}
+
+	server := &graphServer{
+		tpaths:   args,
+		opts:     opts,
+		watching: serveWatch,
+		events:   newEventHub(),
+	}
+	// Start watching before loading, so that no changes are missed
+	var watcher *recipeWatcher
+	if serveWatch {
+		roots := make([]string, len(args))
+		for idx, tpath := range args {
+			roots[idx] = strings.TrimPrefix(tpath, "src:")
+		}
+		if watcher, err = newRecipeWatcher(roots); err != nil {
+			return err
+		}
+	}
+	if err = server.load(cmd.Context()); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graph.json", server.handleGraph)
+	mux.HandleFunc("/reload", server.handleReload)
+	if serveWatch {
+		mux.HandleFunc("/events", server.handleEvents)
+		go server.watch(cmd.Context(), watcher, watchDebounce)
+	}
+
+	// Stop serving on interrupt or --timeout
+	httpServer := &http.Server{Addr: serveAddr, Handler: mux}
+	go func() {
+		<-cmd.Context().Done()
+		httpServer.Close()
+	}()
+
+	waterlog.Infof("Serving graph on %s\n", serveAddr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("Failed to serve: %w", err)
+	}
+	return nil
+}
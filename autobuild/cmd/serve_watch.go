@@ -0,0 +1,314 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+)
+
+// recipeFiles are the files of a recipe that are parsed when loading it.
+var recipeFiles = []string{"package.yml", "pspec_x86_64.xml", "autobuild.yml"}
+
+// recipeChange is a directory under `root` whose recipe files changed, or
+// that has been `removed` along with the recipes in it. The zero value means
+// that changes have been missed, so that everything has to be loaded again.
+type recipeChange struct {
+	dir     string
+	root    string
+	removed bool
+}
+
+// watch updates the graph with the changes reported by `watcher` once there
+// have been none for `debounce`, so that saving many files at once, e.g. when
+// switching branches, only updates it once. It returns when `ctx` is
+// cancelled.
+func (s *graphServer) watch(ctx context.Context, watcher *recipeWatcher, debounce time.Duration) {
+	defer watcher.Close()
+	waterlog.Infof("Watching %d directories for changes\n", watcher.count())
+
+	pending := make(map[string]recipeChange)
+	reload := false
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change, ok := <-watcher.changes:
+			if !ok {
+				return
+			}
+			if change == (recipeChange{}) {
+				reload = true
+			} else if prev, found := pending[change.dir]; !found || !prev.removed {
+				pending[change.dir] = change
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(debounce)
+			continue
+		case <-timer.C:
+		}
+
+		if reload {
+			if err := s.reload(ctx); err != nil {
+				waterlog.Errorf("%s\n", err)
+			}
+		} else if err := s.update(ctx, pending); err != nil {
+			waterlog.Errorf("%s\n", err)
+		}
+		pending = make(map[string]recipeChange)
+		reload = false
+	}
+}
+
+// reload loads everything again after changes have been missed, and sends an
+// "update" event for every package.
+func (s *graphServer) reload(ctx context.Context) error {
+	waterlog.Warnln("Missed some changes, loading everything again")
+	s.mutex.RLock()
+	prevGraph := s.graphData
+	s.mutex.RUnlock()
+	if err := s.load(ctx); err != nil {
+		return err
+	}
+
+	s.mutex.RLock()
+	graphData := s.graphData
+	s.mutex.RUnlock()
+	changed := make([]string, 0, len(graphData.Nodes))
+	for _, node := range graphData.Nodes {
+		changed = append(changed, node.ID)
+	}
+	_, err := s.publishUpdate(prevGraph, graphData, changed)
+	return err
+}
+
+// updateEvent is the data of the "update" events sent on /events.
+type updateEvent struct {
+	// Changed are the packages whose recipe changed, and Affected are
+	// those and every package that transitively depends on them.
+	Changed  []string `json:"changed"`
+	Affected []string `json:"affected"`
+	Nodes    int      `json:"nodes"`
+	Edges    int      `json:"edges"`
+}
+
+// update parses the recipes of the `changed` directories again and updates
+// the graph with depgraph.Update, so that only the edges of the changed
+// packages and their dependents are resolved again. Recipes are reloaded in
+// the source tree they belong to before merging the trees again, so that
+// recipes of later trees still override those of earlier ones. If anything
+// fails, the previous graph is kept and the error is returned.
+func (s *graphServer) update(ctx context.Context, changed map[string]recipeChange) error {
+	s.buildMutex.Lock()
+	defer s.buildMutex.Unlock()
+
+	s.mutex.RLock()
+	sources, prevRaw, prevGraph := slices.Clone(s.sources), s.raw, s.graphData
+	s.mutex.RUnlock()
+
+	var changedSrcs []string
+	for idx, tpath := range s.tpaths {
+		root := strings.TrimPrefix(tpath, "src:")
+		dirs := recipeDirs(sources[idx], root, changed)
+		if len(dirs) == 0 {
+			continue
+		}
+
+		reloaded, err := sources[idx].Reload(root, dirs)
+		if err != nil {
+			return fmt.Errorf("Failed to update the graph, keeping the previous one: %w", err)
+		}
+		changedSrcs = appendRecipeSources(changedSrcs, sources[idx], dirs)
+		changedSrcs = appendRecipeSources(changedSrcs, reloaded, dirs)
+		sources[idx] = reloaded
+	}
+	slices.Sort(changedSrcs)
+
+	state := mergeSources(sources)
+	opts, err := graphOptions(state, s.opts)
+	if err != nil {
+		return fmt.Errorf("Failed to update the graph, keeping the previous one: %w", err)
+	}
+	raw, err := depgraph.Update(ctx, state, prevRaw, changedSrcs, opts.Unfiltered())
+	if err != nil {
+		return fmt.Errorf("Failed to update the graph, keeping the previous one: %w", err)
+	}
+	graphData := raw.Filter(opts)
+
+	s.mutex.Lock()
+	s.sources, s.raw, s.graphData = sources, raw, graphData
+	s.mutex.Unlock()
+
+	event, err := s.publishUpdate(prevGraph, graphData, changedSrcs)
+	if err != nil {
+		return err
+	}
+	waterlog.Goodf("Updated %d changed packages, affecting %d packages\n", len(event.Changed), len(event.Affected))
+	return nil
+}
+
+// publishUpdate sends an "update" event for the `changed` packages to the
+// clients of /events. The affected packages are the ones of `graphData` that
+// transitively depend on them, or did so in `prev`, e.g. if they have been
+// removed.
+func (s *graphServer) publishUpdate(prev depgraph.GraphData, graphData depgraph.GraphData, changed []string) (event updateEvent, err error) {
+	gi := newGraphIndex(graphData)
+	affected := make(map[string]bool)
+	for _, g := range []*graphIndex{newGraphIndex(prev), gi} {
+		var starts []int
+		for _, src := range changed {
+			if idx, found := g.ids[src]; found {
+				starts = append(starts, idx)
+			}
+		}
+		for _, name := range closure(g, starts, -1, true, true) {
+			affected[name] = true
+		}
+	}
+
+	event = updateEvent{
+		Changed:  changed,
+		Affected: make([]string, 0, len(affected)),
+		Nodes:    len(graphData.Nodes),
+		Edges:    len(graphData.Edges),
+	}
+	for name := range affected {
+		if _, found := gi.ids[name]; found {
+			event.Affected = append(event.Affected, name)
+		}
+	}
+	slices.Sort(event.Affected)
+	data, err := json.Marshal(event)
+	if err != nil {
+		return event, fmt.Errorf("Failed to marshal JSON: %w", err)
+	}
+	s.events.publish(data)
+	return
+}
+
+// recipeDirs returns the recipe directories of the `changed` ones under
+// `root`. A removed directory stands for every recipe of `state` under it.
+func recipeDirs(state *st.SourceState, root string, changed map[string]recipeChange) (res []string) {
+	for dir, change := range changed {
+		if change.root != root {
+			continue
+		}
+		if !change.removed {
+			res = append(res, dir)
+			continue
+		}
+		for _, pkg := range state.Packages() {
+			if rel, err := filepath.Rel(dir, pkg.Path); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") && !slices.Contains(res, pkg.Path) {
+				res = append(res, pkg.Path)
+			}
+		}
+	}
+	slices.Sort(res)
+	return slices.Compact(res)
+}
+
+// appendRecipeSources adds the sources of the packages of `state` whose
+// recipe is in any of `dirs` to `res`, unless they are in it already.
+func appendRecipeSources(res []string, state *st.SourceState, dirs []string) []string {
+	isDir := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		isDir[filepath.Clean(dir)] = true
+	}
+	for _, pkg := range state.Packages() {
+		if isDir[filepath.Clean(pkg.Path)] && !slices.Contains(res, pkg.Source) {
+			res = append(res, pkg.Source)
+		}
+	}
+	return res
+}
+
+// mergeSources merges the source states of the served tpaths, in order.
+func mergeSources(sources []*st.SourceState) *st.SourceState {
+	if len(sources) == 1 {
+		return sources[0]
+	}
+	return st.MergeSources(sources)
+}
+
+// eventHub broadcasts events to every client connected to /events.
+type eventHub struct {
+	mutex   sync.Mutex
+	clients map[chan []byte]bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{clients: make(map[chan []byte]bool)}
+}
+
+func (h *eventHub) subscribe() chan []byte {
+	ch := make(chan []byte, 8)
+	h.mutex.Lock()
+	h.clients[ch] = true
+	h.mutex.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan []byte) {
+	h.mutex.Lock()
+	delete(h.clients, ch)
+	h.mutex.Unlock()
+}
+
+// publish sends `data` to every client. Clients that are too slow to keep up
+// miss the event rather than blocking the others.
+func (h *eventHub) publish(data []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+}
+
+func (s *graphServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, errors.New("Streaming is not supported"))
+		return
+	}
+
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-ch:
+			fmt.Fprintf(w, "event: update\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
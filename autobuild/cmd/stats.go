@@ -0,0 +1,195 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsTop  int
+	statsJSON bool
+
+	cmdStats = &cobra.Command{
+		Use:   "stats [src:path]",
+		Short: "Print a summary of the dependency graph",
+		Long: `Print a summary of the build dependency graph between source recipes.
+
+For example: autobuild stats src:../packages --top 10
+
+Leaves are packages without any build dependencies, and roots are packages that
+nothing depends on. Fan-in is the number of packages that depend on a package,
+and fan-out is the number of packages it depends on. Density is the number of
+dependencies divided by the number of possible ones.
+
+The longest chain is the longest path of build dependencies, i.e. the minimum
+number of packages that have to be built one after another even with unlimited
+parallelism. Dependency cycles are collapsed into a single step of the chain
+containing all of their members.`,
+		RunE: runStats,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+type degreeStat struct {
+	Package string `json:"package"`
+	Degree  int    `json:"degree"`
+}
+
+// chainStat is the longest dependency chain, where every step is either a
+// single package or the members of a dependency cycle.
+type chainStat struct {
+	Length          int        `json:"length"`
+	Packages        [][]string `json:"packages"`
+	CyclesCollapsed bool       `json:"cyclesCollapsed,omitempty"`
+}
+
+type graphStats struct {
+	Packages     int          `json:"packages"`
+	Edges        int          `json:"edges"`
+	Density      float64      `json:"density"`
+	LongestChain chainStat    `json:"longestChain"`
+	Base         int          `json:"base"`
+	Leaves       int          `json:"leaves"`
+	Roots        int          `json:"roots"`
+	MaxFanIn     degreeStat   `json:"maxFanIn"`
+	MaxFanOut    degreeStat   `json:"maxFanOut"`
+	Unresolved   int          `json:"unresolved"`
+	Top          []degreeStat `json:"top,omitempty"`
+}
+
+func init() {
+	cmdStats.Flags().IntVar(&statsTop, "top", 0, "also list the N most depended-upon packages")
+	cmdStats.Flags().BoolVar(&statsJSON, "json", false, "output the statistics as JSON")
+}
+
+func computeStats(state st.State, gi *graphIndex, top int) (stats graphStats) {
+	inDegrees := gi.inDegrees()
+	fanIn := make([]degreeStat, len(gi.data.Nodes))
+
+	stats.Packages = len(gi.data.Nodes)
+	for v, node := range gi.data.Nodes {
+		out := gi.g.Degree(v)
+		fanIn[v] = degreeStat{Package: node.ID, Degree: inDegrees[v]}
+
+		stats.Edges += out
+		if node.IsBase {
+			stats.Base++
+		}
+		if out == 0 {
+			stats.Leaves++
+		}
+		if inDegrees[v] == 0 {
+			stats.Roots++
+		}
+		if out > stats.MaxFanOut.Degree {
+			stats.MaxFanOut = degreeStat{Package: node.ID, Degree: out}
+		}
+	}
+
+	if n := stats.Packages; n > 1 {
+		stats.Density = float64(stats.Edges) / float64(n*(n-1))
+	}
+	chain := gi.data.LongestChain()
+	stats.LongestChain = chainStat{
+		Length:          len(chain),
+		Packages:        chain,
+		CyclesCollapsed: len(findCycles(gi)) > 0,
+	}
+
+	for _, deps := range unresolvedDeps(state) {
+		stats.Unresolved += len(deps)
+	}
+
+	// Highest fan-in first, alphabetically on ties
+	slices.SortStableFunc(fanIn, func(a, b degreeStat) int {
+		if a.Degree != b.Degree {
+			return cmp.Compare(b.Degree, a.Degree)
+		}
+		return strings.Compare(a.Package, b.Package)
+	})
+	if len(fanIn) > 0 {
+		stats.MaxFanIn = fanIn[0]
+	}
+	if top > 0 {
+		stats.Top = fanIn[:min(top, len(fanIn))]
+	}
+
+	return
+}
+
+func runStats(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	stats := computeStats(state, newGraphIndex(graphData), statsTop)
+
+	if statsJSON {
+		out, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Packages\t%d\n", stats.Packages)
+	fmt.Fprintf(w, "Dependencies\t%d\n", stats.Edges)
+	fmt.Fprintf(w, "Density\t%.4f\n", stats.Density)
+	fmt.Fprintf(w, "Base packages\t%d\n", stats.Base)
+	fmt.Fprintf(w, "Leaf packages\t%d\n", stats.Leaves)
+	fmt.Fprintf(w, "Root packages\t%d\n", stats.Roots)
+	fmt.Fprintf(w, "Max fan-in\t%d (%s)\n", stats.MaxFanIn.Degree, stats.MaxFanIn.Package)
+	fmt.Fprintf(w, "Max fan-out\t%d (%s)\n", stats.MaxFanOut.Degree, stats.MaxFanOut.Package)
+	fmt.Fprintf(w, "Unresolved deps\t%d\n", stats.Unresolved)
+	fmt.Fprintf(w, "Longest chain\t%d\n", stats.LongestChain.Length)
+	w.Flush()
+
+	if stats.LongestChain.Length > 0 {
+		steps := make([]string, len(stats.LongestChain.Packages))
+		for idx, step := range stats.LongestChain.Packages {
+			if len(step) > 1 {
+				steps[idx] = "{" + strings.Join(step, " ") + "}"
+			} else {
+				steps[idx] = step[0]
+			}
+		}
+		fmt.Println("\nLongest chain:")
+		fmt.Printf("  %s\n", strings.Join(steps, " -> "))
+		if stats.LongestChain.CyclesCollapsed {
+			fmt.Println("  (dependency cycles are collapsed into the packages in braces)")
+		}
+	}
+
+	if len(stats.Top) > 0 {
+		fmt.Println("\nMost depended-upon:")
+		for _, s := range stats.Top {
+			fmt.Fprintf(w, "  %s\t%d\n", s.Package, s.Degree)
+		}
+		w.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	subgraphDepth   int
+	subgraphReverse bool
+	subgraphGitDiff string
+
+	cmdSubgraph = &cobra.Command{
+		Use:   "subgraph [src:path] [package] [output]",
+		Short: "Export the dependency closure of a single package as JSON",
+		Long: `Export the part of the dependency graph that is reachable from the given
+source recipe, in the same JSON format as export-json.
+
+For example: autobuild subgraph src:../packages rocblas rocblas.json
+
+By default the transitive build dependencies of the package are exported. With
+--reverse, the packages that transitively depend on it are exported instead.
+
+The package can be given as a shell-style glob such as "python-*", or as a
+regular expression with --regex, in which case the closures of all matching
+packages are exported together. Pass "-" as the package to read the packages
+from stdin, one per line, and export their closures together.
+
+With --git-diff REF, the package is left out and the packages whose recipes
+changed since the git revision REF are used instead, e.g.:
+
+    autobuild subgraph src:../packages --git-diff origin/main changed.json
+
+Both their dependencies and their dependents are exported. Changed files that
+don't belong to any recipe are skipped with a warning.`,
+		RunE: runSubgraph,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if subgraphGitDiff != "" {
+				return cobra.ExactArgs(2)(cmd, args)
+			}
+			return cobra.ExactArgs(3)(cmd, args)
+		},
+	}
+)
+
+func init() {
+	cmdSubgraph.Flags().IntVarP(&subgraphDepth, "depth", "d", -1, "maximum number of hops to traverse, unlimited if negative")
+	cmdSubgraph.Flags().BoolVarP(&subgraphReverse, "reverse", "r", false, "export the packages that depend on the package instead")
+	cmdSubgraph.Flags().StringVar(&subgraphGitDiff, "git-diff", "", "export the closures of the recipes changed since this git revision")
+	selectFlagsInit(cmdSubgraph)
+	compactFlagInit(cmdSubgraph)
+	modeFlagInit(cmdSubgraph)
+}
+
+// gitChangedFiles returns the files under `dir` that changed since `ref`,
+// relative to `dir`.
+func gitChangedFiles(dir string, ref string) ([]string, error) {
+	gitCmd := exec.Command("git", "diff", "--name-only", "--relative", ref, "--")
+	gitCmd.Dir = dir
+	out, err := gitCmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("Failed to diff against %s: %s", ref, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("Failed to run git: %w", err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// changedSources maps the `files` changed under `root` to the sources of the
+// recipes that contain them. The files outside of any recipe are returned
+// separately.
+func changedSources(state st.State, root string, files []string) (srcs []string, unknown []string) {
+	dirToSrc := make(map[string]string)
+	for _, pkg := range state.Packages() {
+		if dir, err := filepath.Rel(root, pkg.Path); err == nil {
+			dirToSrc[dir] = pkg.Source
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, file := range files {
+		src, found := "", false
+		for dir := filepath.Dir(filepath.Clean(file)); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+			if src, found = dirToSrc[dir]; found {
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, file)
+		} else if !seen[src] {
+			seen[src] = true
+			srcs = append(srcs, src)
+		}
+	}
+	return
+}
+
+func runSubgraph(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	outputPath := args[len(args)-1]
+	redirectLogs(outputPath)
+
+	root, isSrc := strings.CutPrefix(tpath, "src:")
+	if subgraphGitDiff != "" && !isSrc {
+		return fmt.Errorf("--git-diff only supports source tpaths, got %s", tpath)
+	}
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	var keep map[int]bool
+	if subgraphGitDiff != "" {
+		if keep, err = changedClosure(state, gi, root); err != nil {
+			return err
+		}
+	} else {
+		starts, err := selectPackages(gi, []string{args[1]})
+		if err != nil {
+			return err
+		}
+		keep = gi.reachable(starts, subgraphDepth, subgraphReverse)
+	}
+	graphData = gi.data.Subgraph(func(node depgraph.GraphNode) bool { return keep[gi.ids[node.ID]] })
+
+	size, err := writeGraphJSON(graphData, outputPath)
+	if err != nil {
+		return err
+	}
+	reportExport(graphData, outputPath, size)
+	return nil
+}
+
+// gitChangedRecipes returns the vertices of the recipes under `root` that changed
+// since the git revision `ref`.
+func gitChangedRecipes(state st.State, gi *graphIndex, root string, ref string) ([]int, error) {
+	files, err := gitChangedFiles(root, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	srcs, unknown := changedSources(state, root, files)
+	if len(unknown) > 0 {
+		waterlog.Warnf("Skipped %d changed file(s) outside of any recipe\n", len(unknown))
+		for _, file := range unknown {
+			waterlog.Debugf("Not part of a recipe: %s\n", file)
+		}
+	}
+
+	var starts []int
+	for _, src := range srcs {
+		// Ignored packages are not part of the graph
+		if idx, found := gi.ids[src]; found {
+			starts = append(starts, idx)
+		}
+	}
+	waterlog.Infof("%d recipe(s) changed since %s\n", len(starts), ref)
+	return starts, nil
+}
+
+// changedClosure returns the dependencies and dependents of the recipes under
+// `root` that changed since --git-diff.
+func changedClosure(state st.State, gi *graphIndex, root string) (map[int]bool, error) {
+	starts, err := gitChangedRecipes(state, gi, root, subgraphGitDiff)
+	if err != nil {
+		return nil, err
+	}
+	keep := gi.reachable(starts, subgraphDepth, false)
+	for idx := range gi.reachable(starts, subgraphDepth, true) {
+		keep[idx] = true
+	}
+	return keep, nil
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// maxSuggestions is the maximum number of names suggested by didYouMean.
+const maxSuggestions = 5
+
+// levenshtein returns the edit distance between `a` and `b`.
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// didYouMean returns up to maxSuggestions of the `candidates` that are the
+// closest to `name`, closest first. Candidates that are too far off to be a
+// typo are left out.
+func didYouMean(name string, candidates []string) []string {
+	type suggestion struct {
+		name string
+		dist int
+	}
+
+	maxDist := max(2, len(name)/3)
+	var suggestions []suggestion
+	for _, candidate := range candidates {
+		if dist := levenshtein(name, candidate); dist <= maxDist {
+			suggestions = append(suggestions, suggestion{candidate, dist})
+		}
+	}
+	slices.SortFunc(suggestions, func(a, b suggestion) int {
+		if c := cmp.Compare(a.dist, b.dist); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.name, b.name)
+	})
+
+	res := make([]string, 0, maxSuggestions)
+	for idx := 0; idx < len(suggestions) && idx < maxSuggestions; idx++ {
+		res = append(res, suggestions[idx].name)
+	}
+	return res
+}
+
+// unknownPackage returns the error for a package `name` that isn't part of
+// the graph, suggesting the closest package names if there are any.
+func unknownPackage(gi *graphIndex, name string) error {
+	names := make([]string, len(gi.data.Nodes))
+	for idx, node := range gi.data.Nodes {
+		names[idx] = node.ID
+	}
+
+	if suggestions := didYouMean(name, names); len(suggestions) > 0 {
+		return fmt.Errorf("Unable to find package %s, did you mean %s?", name, strings.Join(suggestions, ", "))
+	}
+	return fmt.Errorf("Unable to find package %s", name)
+}
+
+// lookup returns the vertex of the package `name`, or an error with
+// suggestions if there is no such package.
+func (gi *graphIndex) lookup(name string) (int, error) {
+	idx, found := gi.ids[name]
+	if !found {
+		return -1, unknownPackage(gi, name)
+	}
+	return idx, nil
+}
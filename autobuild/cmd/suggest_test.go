@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "zlib", 4},
+		{"zlib", "", 4},
+		{"zlib", "zlib", 0},
+		{"zlib", "zlub", 1},
+		{"zlib", "zlibs", 1},
+		{"zlib", "lib", 1},
+		{"kitten", "sitting", 3},
+		{"glibc", "gcc", 3},
+		{"pkgconfig", "pkg-config", 1},
+		// Distances are counted in runes, not bytes
+		{"ü", "u", 1},
+	}
+
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := levenshtein(tt.b, tt.a); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	candidates := []string{"glibc", "glib2", "gcc", "zlib", "zlib-ng", "python", "python3", "python-pip"}
+
+	tests := []struct {
+		name       string
+		candidates []string
+		want       []string
+	}{
+		{name: "zlib", candidates: candidates, want: []string{"zlib", "glib2", "glibc"}},
+		{name: "zlb", candidates: candidates, want: []string{"zlib"}},
+		{name: "glbc", candidates: candidates, want: []string{"glibc", "gcc", "glib2"}},
+		{name: "pythn", candidates: candidates, want: []string{"python", "python3"}},
+		{name: "rust", candidates: candidates, want: []string{}},
+		{name: "zlib", candidates: nil, want: []string{}},
+		{
+			name:       "a",
+			candidates: []string{"f", "e", "d", "c", "b", "a"},
+			want:       []string{"a", "b", "c", "d", "e"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := didYouMean(tt.name, tt.candidates); !slices.Equal(got, tt.want) {
+			t.Errorf("didYouMean(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
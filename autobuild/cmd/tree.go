@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+	"github.com/yourbasic/graph"
+)
+
+var (
+	treeDepth   int
+	treeReverse bool
+
+	cmdTree = &cobra.Command{
+		Use:   "tree [src:path] [package]",
+		Short: "Print the build dependency tree of a package",
+		Long: `Print the transitive build dependencies of the given source recipe as a tree,
+like npm ls does.
+
+For example: autobuild tree src:../packages rocblas
+
+The dependencies of every package are listed in alphabetical order. Packages
+that have already been expanded earlier in the tree are marked with (*) and
+not expanded again, which also keeps cycles from being expanded forever. With
+--reverse, the packages that depend on the package are printed instead.`,
+		RunE: runTree,
+		Args: cobra.ExactArgs(2),
+	}
+)
+
+func init() {
+	cmdTree.Flags().IntVarP(&treeDepth, "depth", "d", -1, "maximum depth of the tree, unlimited if negative")
+	cmdTree.Flags().BoolVarP(&treeReverse, "reverse", "r", false, "print the packages that depend on the package instead")
+}
+
+// printTree prints the children of `v` in `g` below it, with every line
+// starting with `prefix`. Vertices in `shown` have already been expanded.
+func printTree(gi *graphIndex, g graph.Iterator, v int, prefix string, depth int, shown map[int]bool) {
+	if treeDepth >= 0 && depth >= treeDepth {
+		return
+	}
+
+	var children []int
+	g.Visit(v, func(w int, _ int64) (skip bool) {
+		children = append(children, w)
+		return
+	})
+
+	for idx, child := range children {
+		branch, indent := "├── ", "│   "
+		if idx == len(children)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		if shown[child] {
+			fmt.Printf("%s%s%s (*)\n", prefix, branch, gi.data.Nodes[child].ID)
+			continue
+		}
+		fmt.Printf("%s%s%s\n", prefix, branch, gi.data.Nodes[child].ID)
+		shown[child] = true
+		printTree(gi, g, child, prefix+indent, depth+1, shown)
+	}
+}
+
+func runTree(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	name := args[1]
+	waterlog.SetOutput(os.Stderr)
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	root, err := gi.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	var g graph.Iterator = gi.g
+	if treeReverse {
+		g = graph.Sort(graph.Transpose(gi.g))
+	}
+
+	fmt.Println(name)
+	printTree(gi, g, root, "", 0, map[int]bool{root: true})
+	return nil
+}
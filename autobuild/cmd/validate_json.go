@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	"github.com/spf13/cobra"
+)
+
+var (
+	printSchema bool
+
+	cmdValidateJSON = &cobra.Command{
+		Use:   "validate-json [graph.json]",
+		Short: "Check a graph exported as JSON against its schema",
+		Long: `Validate a graph written by export-json against the JSON Schema of the
+export format, and report every field that is missing, unknown or of the
+wrong type, along with its path in the document.
+
+For example: autobuild validate-json ../depgraph/public/graph.json
+
+The schema is defined in depgraph/graph.schema.json and embedded into the
+binary. It only accepts the current schema version. Pass --print-schema to
+print it instead, in which case no file is needed. Exits with a non-zero
+status if the file doesn't match the schema.`,
+		RunE: runValidateJSON,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if printSchema {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+	}
+)
+
+func init() {
+	cmdValidateJSON.Flags().BoolVar(&printSchema, "print-schema", false, "print the JSON Schema of the export format and exit")
+}
+
+func runValidateJSON(cmd *cobra.Command, args []string) error {
+	if printSchema {
+		os.Stdout.Write(depgraph.Schema)
+		return nil
+	}
+
+	path := args[0]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read graph: %w", err)
+	}
+
+	problems, err := depgraph.ValidateSchema(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, problem := range problems {
+		waterlog.Errorf("Invalid: ")
+		fmt.Println(problem)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Found %d problem(s) in %s", len(problems), path)
+	}
+	waterlog.Goodf("%s matches the schema!\n", path)
+	return nil
+}
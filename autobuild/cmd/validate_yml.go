@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/ypkg"
+	"github.com/spf13/cobra"
+)
+
+var cmdValidateYml = &cobra.Command{
+	Use:   "validate-yml [src:path]",
+	Short: "Report package.yml files that fail to parse",
+	Long: `Parse every package.yml under a source tree and report each file that fails
+to parse, along with the error.
+
+For example: autobuild validate-yml src:../packages
+
+Recipes whose package.yml can't be parsed silently lose their component and
+base classification in the exported graphs, so this is meant to run before
+merging. Exits with a non-zero status if any file fails to parse.`,
+	RunE: runValidateYml,
+	Args: cobra.ExactArgs(1),
+}
+
+// invalidYmls returns the package.yml files under `root` that fail to parse,
+// along with their error.
+func invalidYmls(root string) (failed map[string]error, total int, err error) {
+	failed = make(map[string]error)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || d.Name() != "package.yml" {
+			return nil
+		}
+
+		total++
+		if _, err := ypkg.Load(path); err != nil {
+			failed[path] = err
+		}
+		return nil
+	})
+	return
+}
+
+func runValidateYml(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	root, ok := strings.CutPrefix(tpath, "src:")
+	if !ok {
+		return fmt.Errorf("validate-yml only supports source tpaths, got %s", tpath)
+	}
+
+	failed, total, err := invalidYmls(root)
+	if err != nil {
+		return fmt.Errorf("Failed to walk %s: %w", root, err)
+	}
+
+	// WalkDir visits the files in lexical order, but the map doesn't keep it
+	paths := make([]string, 0, len(failed))
+	for path := range failed {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	for _, path := range paths {
+		waterlog.Errorf("%s: %s\n", path, failed[path])
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d package.yml files failed to parse", len(failed), total)
+	}
+	waterlog.Goodf("All %d package.yml files parsed successfully!\n", total)
+	return nil
+}
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/spf13/cobra"
+)
+
+var cmdVerifyOrder = &cobra.Command{
+	Use:   "verify-order [src:path] [orderfile]",
+	Short: "Check that a build order lists every package after its dependencies",
+	Long: `Read an ordered list of source recipes, one per line, and check that every
+package comes after all of its build dependencies that are part of the list.
+
+For example: autobuild verify-order src:../packages build-order.txt
+
+Empty lines and lines starting with "#" are skipped. Dependencies that are not
+listed are assumed to be built already. The first package that comes before one
+of its dependencies is reported, along with the number of such violations, and
+the command exits with a non-zero status. Packages that are part of a
+dependency cycle can never be ordered correctly.`,
+	RunE: runVerifyOrder,
+	Args: cobra.ExactArgs(2),
+}
+
+// orderEntry is a package listed in an order file, with its line number.
+type orderEntry struct {
+	name string
+	line int
+}
+
+// readOrderFile reads the packages listed in the order file at `filename`.
+func readOrderFile(filename string) (entries []orderEntry, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read order file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, orderEntry{name: line, line: lineNum})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", filename, err)
+	}
+	return
+}
+
+// orderViolation is a package listed before one of its dependencies.
+type orderViolation struct {
+	pkg orderEntry
+	dep orderEntry
+}
+
+// orderViolations returns the packages of `entries` that come before any of
+// their dependencies in the graph, in the order of `entries`. Packages listed
+// more than once only count at their first line.
+func orderViolations(graphData depgraph.GraphData, entries []orderEntry) (res []orderViolation) {
+	positions := make(map[string]int, len(entries))
+	for idx, entry := range entries {
+		if _, seen := positions[entry.name]; !seen {
+			positions[entry.name] = idx
+		}
+	}
+
+	deps := make(map[string][]string)
+	for _, edge := range graphData.Edges {
+		deps[edge.Source] = append(deps[edge.Source], edge.Target)
+	}
+
+	for idx, entry := range entries {
+		if positions[entry.name] != idx {
+			continue
+		}
+		for _, dep := range deps[entry.name] {
+			if depIdx, listed := positions[dep]; listed && depIdx > idx {
+				res = append(res, orderViolation{pkg: entry, dep: entries[depIdx]})
+			}
+		}
+	}
+	return
+}
+
+func runVerifyOrder(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	orderPath := args[1]
+
+	entries, err := readOrderFile(orderPath)
+	if err != nil {
+		return err
+	}
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	seen := make(map[string]bool, len(entries))
+	unknown := 0
+	for _, entry := range entries {
+		if seen[entry.name] {
+			waterlog.Warnf("%s is listed again on line %d\n", entry.name, entry.line)
+			continue
+		}
+		seen[entry.name] = true
+		if _, err := gi.lookup(entry.name); err != nil {
+			waterlog.Errorf("Line %d: %s\n", entry.line, err)
+			unknown++
+		}
+	}
+	if unknown > 0 {
+		return fmt.Errorf("Found %d unknown package(s) in %s", unknown, orderPath)
+	}
+
+	violations := orderViolations(gi.data, entries)
+	if len(violations) == 0 {
+		waterlog.Goodf("All %d packages come after their dependencies!\n", len(seen))
+		return nil
+	}
+
+	first := violations[0]
+	waterlog.Errorf("%s: ", first.pkg.name)
+	fmt.Printf("listed on line %d, before its dependency %s on line %d\n", first.pkg.line, first.dep.name, first.dep.line)
+	return fmt.Errorf("Found %d dependencies listed after packages that depend on them", len(violations))
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrderViolations(t *testing.T) {
+	nodes := []string{"bash", "glibc", "ncurses", "readline"}
+	edges := [][2]string{{"bash", "readline"}, {"bash", "ncurses"}, {"readline", "ncurses"}, {"ncurses", "glibc"}}
+
+	tests := []struct {
+		name  string
+		order []string
+		want  []orderViolation
+	}{
+		{
+			name:  "valid order",
+			order: []string{"glibc", "ncurses", "readline", "bash"},
+		},
+		{
+			name:  "unlisted dependencies",
+			order: []string{"readline", "bash"},
+		},
+		{
+			name:  "dependency after package",
+			order: []string{"glibc", "readline", "ncurses", "bash"},
+			want: []orderViolation{
+				{pkg: orderEntry{"readline", 2}, dep: orderEntry{"ncurses", 3}},
+			},
+		},
+		{
+			name:  "violations in list order",
+			order: []string{"bash", "readline", "ncurses", "glibc"},
+			want: []orderViolation{
+				{pkg: orderEntry{"bash", 1}, dep: orderEntry{"readline", 2}},
+				{pkg: orderEntry{"bash", 1}, dep: orderEntry{"ncurses", 3}},
+				{pkg: orderEntry{"readline", 2}, dep: orderEntry{"ncurses", 3}},
+				{pkg: orderEntry{"ncurses", 3}, dep: orderEntry{"glibc", 4}},
+			},
+		},
+		{
+			name:  "repeated package counts at its first line",
+			order: []string{"glibc", "ncurses", "bash", "readline", "bash"},
+			want: []orderViolation{
+				{pkg: orderEntry{"bash", 3}, dep: orderEntry{"readline", 4}},
+			},
+		},
+		{
+			name:  "repeated dependency counts at its first line",
+			order: []string{"ncurses", "glibc", "glibc"},
+			want: []orderViolation{
+				{pkg: orderEntry{"ncurses", 1}, dep: orderEntry{"glibc", 2}},
+			},
+		},
+	}
+
+	graphData := testGraphIndex(nodes, edges).data
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := make([]orderEntry, len(tt.order))
+			for idx, name := range tt.order {
+				entries[idx] = orderEntry{name: name, line: idx + 1}
+			}
+			if got := orderViolations(graphData, entries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("orderViolations() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
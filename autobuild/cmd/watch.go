@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/fsnotify/fsnotify"
+)
+
+// recipeWatcher watches every directory under a set of roots with fsnotify,
+// and sends the recipe directories whose files change on `changes`.
+type recipeWatcher struct {
+	watcher *fsnotify.Watcher
+	changes chan recipeChange
+
+	// Watched directories, mapped to the root they are under
+	mutex sync.Mutex
+	dirs  map[string]string
+}
+
+// newRecipeWatcher starts watching every directory under `roots`, except for
+// .git directories. Directories created later on are watched as well.
+func newRecipeWatcher(roots []string) (*recipeWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to watch for changes: %w", err)
+	}
+	w := &recipeWatcher{
+		watcher: watcher,
+		changes: make(chan recipeChange, 64),
+		dirs:    make(map[string]string),
+	}
+	for _, root := range roots {
+		if _, err = w.addTree(filepath.Clean(root), filepath.Clean(root)); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	go w.read()
+	return w, nil
+}
+
+// Close stops watching, after which no more changes are sent.
+func (w *recipeWatcher) Close() error {
+	return w.watcher.Close()
+}
+
+// count returns the number of watched directories.
+func (w *recipeWatcher) count() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.dirs)
+}
+
+// addTree watches `dir` and every directory under it, and returns the recipe
+// directories among them.
+func (w *recipeWatcher) addTree(root string, dir string) (recipes []string, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// The directory may have been removed again in the meantime
+			if errors.Is(err, fs.ErrNotExist) && path != root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() {
+			if d.Name() == "package.yml" {
+				recipes = append(recipes, filepath.Dir(path))
+			}
+			return nil
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		err = w.watcher.Add(path)
+		if errors.Is(err, syscall.ENOSPC) {
+			return fmt.Errorf("Failed to watch %s: too many directories, raise fs.inotify.max_user_watches", path)
+		} else if err != nil {
+			return fmt.Errorf("Failed to watch %s: %w", path, err)
+		}
+		w.mutex.Lock()
+		w.dirs[path] = root
+		w.mutex.Unlock()
+		return nil
+	})
+	return
+}
+
+// removeTree stops watching `dir` and every directory under it.
+func (w *recipeWatcher) removeTree(dir string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for path := range w.dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			// Removed directories are no longer watched anyway
+			_ = w.watcher.Remove(path)
+			delete(w.dirs, path)
+		}
+	}
+}
+
+// rootOf returns the root that the watched directory `dir` is under.
+func (w *recipeWatcher) rootOf(dir string) (root string, found bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	root, found = w.dirs[dir]
+	return
+}
+
+// read turns the fsnotify events into changes until the watcher is closed.
+func (w *recipeWatcher) read() {
+	defer close(w.changes)
+
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// Events have been lost, so anything may have changed
+				w.changes <- recipeChange{}
+			} else {
+				waterlog.Errorf("Failed to read file changes: %s\n", err)
+			}
+		}
+	}
+}
+
+// handle sends the changes caused by an fsnotify event.
+func (w *recipeWatcher) handle(event fsnotify.Event) {
+	path := filepath.Clean(event.Name)
+	dir, name := filepath.Dir(path), filepath.Base(path)
+	root, found := w.rootOf(dir)
+	if !found || name == ".git" {
+		return
+	}
+	_, isDir := w.rootOf(path)
+
+	switch {
+	case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+		// Renamed files are created again under their new name
+		if isDir {
+			w.removeTree(path)
+			w.changes <- recipeChange{dir: path, root: root, removed: true}
+		} else if slices.Contains(recipeFiles, name) {
+			w.changes <- recipeChange{dir: dir, root: root}
+		}
+	case event.Has(fsnotify.Create):
+		if info, err := os.Lstat(path); err == nil && info.IsDir() {
+			recipes, err := w.addTree(root, path)
+			if err != nil {
+				waterlog.Errorf("%s\n", err)
+			}
+			for _, recipe := range recipes {
+				w.changes <- recipeChange{dir: recipe, root: root}
+			}
+		} else if slices.Contains(recipeFiles, name) {
+			w.changes <- recipeChange{dir: dir, root: root}
+		}
+	case event.Has(fsnotify.Write):
+		if slices.Contains(recipeFiles, name) {
+			w.changes <- recipeChange{dir: dir, root: root}
+		}
+	}
+}
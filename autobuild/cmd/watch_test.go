@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// nextChange waits for the next change reported by `w` other than `skip`,
+// which may be reported more than once.
+func nextChange(t *testing.T, w *recipeWatcher, skip recipeChange) recipeChange {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case change, ok := <-w.changes:
+			if !ok {
+				t.Fatalf("watcher stopped")
+			}
+			if change != skip {
+				return change
+			}
+		case <-timeout:
+			t.Fatalf("no change reported")
+		}
+	}
+}
+
+func TestRecipeWatcher(t *testing.T) {
+	root := t.TempDir()
+	lib := filepath.Join(root, "l", "lib")
+	if err := os.MkdirAll(lib, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(lib, "package.yml"), []byte("name: lib\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := newRecipeWatcher([]string{root})
+	if err != nil {
+		t.Fatalf("Failed to watch %s: %s", root, err)
+	}
+	defer w.Close()
+	if n := w.count(); n != 3 {
+		t.Errorf("watching %d directories, want 3 without .git", n)
+	}
+
+	// Modified recipe
+	if err = os.WriteFile(filepath.Join(lib, "package.yml"), []byte("name: lib\nrelease: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := recipeChange{dir: lib, root: root}
+	if got := nextChange(t, w, recipeChange{}); got != want {
+		t.Fatalf("change = %+v, want %+v", got, want)
+	}
+
+	// New recipe in a new directory, whose files may or may not be created
+	// before it is watched
+	app := filepath.Join(root, "a", "app")
+	if err = os.MkdirAll(app, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(app, "package.yml"), []byte("name: app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want = recipeChange{dir: app, root: root}
+	if got := nextChange(t, w, recipeChange{dir: lib, root: root}); got != want {
+		t.Fatalf("change = %+v, want %+v", got, want)
+	}
+
+	// Removed directory
+	if err = os.RemoveAll(filepath.Join(root, "l")); err != nil {
+		t.Fatal(err)
+	}
+	want = recipeChange{dir: filepath.Join(root, "l"), root: root, removed: true}
+	for {
+		got := nextChange(t, w, recipeChange{dir: app, root: root})
+		if got == want {
+			break
+		}
+		// The recipe and its directory are removed first
+		if got != (recipeChange{dir: lib, root: root}) && got != (recipeChange{dir: lib, root: root, removed: true}) {
+			t.Fatalf("change = %+v, want %+v", got, want)
+		}
+	}
+}
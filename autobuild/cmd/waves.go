@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/spf13/cobra"
+	"github.com/yourbasic/graph"
+)
+
+var (
+	maxWaveSize int
+
+	cmdWaves = &cobra.Command{
+		Use:   "waves [src:path]",
+		Short: "Print the build order as waves of packages that can be built concurrently",
+		Long: `Split the build order into waves, printed as JSON. The first wave contains the
+packages without build dependencies, and every later wave only depends on the
+packages of the waves before it, so all the packages of a wave can be built
+concurrently.
+
+For example: autobuild waves src:../packages > waves.json
+
+Packages that are part of or depend on a cycle can't be put in any wave, and
+are listed under "blocked" instead.`,
+		RunE: runWaves,
+		Args: cobra.ExactArgs(1),
+	}
+)
+
+// wavesManifest is the output of waves.
+type wavesManifest struct {
+	Waves   [][]string `json:"waves"`
+	Blocked []string   `json:"blocked"`
+}
+
+func init() {
+	cmdWaves.Flags().IntVar(&maxWaveSize, "max-wave-size", 0, "warn about waves with more packages than this, disabled if not positive")
+}
+
+// buildWaves splits the packages of the graph into build waves and the
+// packages that are blocked by cycles.
+func buildWaves(gi *graphIndex) (manifest wavesManifest) {
+	// Edges go from a package to its dependencies, but dependencies have to
+	// come first.
+	tiers, _ := utils.TieredTopSort(graph.Transpose(gi.g))
+
+	placed := make([]bool, len(gi.data.Nodes))
+	manifest.Waves = make([][]string, len(tiers))
+	for tierIdx, tier := range tiers {
+		manifest.Waves[tierIdx] = gi.names(tier)
+		for _, v := range tier {
+			placed[v] = true
+		}
+	}
+
+	manifest.Blocked = make([]string, 0)
+	for v, node := range gi.data.Nodes {
+		if !placed[v] {
+			manifest.Blocked = append(manifest.Blocked, node.ID)
+		}
+	}
+
+	return
+}
+
+func runWaves(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+	waterlog.SetOutput(os.Stderr)
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	manifest := buildWaves(newGraphIndex(graphData))
+	for waveIdx, wave := range manifest.Waves {
+		if maxWaveSize > 0 && len(wave) > maxWaveSize {
+			waterlog.Warnf("Wave %d has %d packages, more than %d\n", waveIdx, len(wave), maxWaveSize)
+		}
+	}
+	if len(manifest.Blocked) > 0 {
+		waterlog.Warnf("%d package(s) are blocked by cycles\n", len(manifest.Blocked))
+	}
+
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to marshal JSON: %w", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildWaves(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []string
+		edges [][2]string
+		want  wavesManifest
+	}{
+		{
+			name:  "single wave",
+			nodes: []string{"zlib", "bash", "glibc"},
+			want:  wavesManifest{Waves: [][]string{{"zlib", "bash", "glibc"}}, Blocked: []string{}},
+		},
+		{
+			name:  "dependencies in earlier waves",
+			nodes: []string{"bash", "glibc", "readline", "zlib"},
+			edges: [][2]string{{"bash", "readline"}, {"readline", "glibc"}, {"zlib", "glibc"}},
+			want: wavesManifest{
+				Waves:   [][]string{{"glibc"}, {"readline", "zlib"}, {"bash"}},
+				Blocked: []string{},
+			},
+		},
+		{
+			name:  "cycles block dependents",
+			nodes: []string{"a", "b", "c", "d"},
+			edges: [][2]string{{"a", "b"}, {"b", "a"}, {"c", "a"}, {"c", "d"}},
+			want: wavesManifest{
+				Waves:   [][]string{{"d"}},
+				Blocked: []string{"a", "b", "c"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildWaves(testGraphIndex(tt.nodes, tt.edges))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildWaves() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/depgraph"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/spf13/cobra"
+	"github.com/yourbasic/graph"
+)
+
+var (
+	whyAll     bool
+	whyMaxHops int
+
+	cmdWhy = &cobra.Command{
+		Use:   "why [src:path] [from] [to]",
+		Short: "Explain why a package build-depends on another one",
+		Long: `Print a shortest build dependency path from one source recipe to another,
+along with the build dependencies that connect every hop.
+
+For example: autobuild why src:../packages rocblas llvm
+
+With --all, every path without repeated packages of at most --max-hops hops is
+printed instead. Exits with a non-zero status if there is no path.`,
+		RunE: runWhy,
+		Args: cobra.ExactArgs(3),
+	}
+)
+
+func init() {
+	cmdWhy.Flags().BoolVar(&whyAll, "all", false, "print all paths instead of a shortest one")
+	cmdWhy.Flags().IntVar(&whyMaxHops, "max-hops", 6, "maximum number of hops of the paths printed with --all")
+}
+
+// edgeProviders returns the sorted build dependencies of `src` that resolve to
+// a package of `target`.
+func edgeProviders(state st.State, src string, target string) (res []string) {
+	ids := state.SrcToPkgIds()[src]
+	if len(ids) == 0 {
+		return
+	}
+
+	packages := state.Packages()
+	pvdToPkgIdx := state.PvdToPkgIdx()
+	pkg := packages[ids[0]]
+	for _, dep := range append(slices.Clone(pkg.OwnBuildDeps), pkg.CheckDeps...) {
+		if depIdx, found := pvdToPkgIdx[dep]; found && packages[depIdx].Source == target {
+			res = append(res, dep)
+		}
+	}
+	slices.Sort(res)
+	return utils.Uniq2(res)
+}
+
+// simplePaths returns every path from `from` to `to` that doesn't visit a
+// vertex twice and has at most `maxHops` edges, in depth-first order.
+func simplePaths(g graph.Iterator, from int, to int, maxHops int) (res [][]int) {
+	path := []int{from}
+	onPath := map[int]bool{from: true}
+
+	var visit func(v int)
+	visit = func(v int) {
+		if v == to {
+			res = append(res, slices.Clone(path))
+			return
+		}
+		if len(path) > maxHops {
+			return
+		}
+		g.Visit(v, func(w int, _ int64) (skip bool) {
+			if !onPath[w] {
+				path = append(path, w)
+				onPath[w] = true
+				visit(w)
+				onPath[w] = false
+				path = path[:len(path)-1]
+			}
+			return
+		})
+	}
+	visit(from)
+
+	return
+}
+
+// printPath prints every hop of `path` with the build dependencies that
+// connect them.
+func printPath(state st.State, gi *graphIndex, path []int) {
+	names := gi.names(path)
+	for i := 1; i < len(names); i++ {
+		fmt.Printf("%s -> %s (%s)\n", names[i-1], names[i], strings.Join(edgeProviders(state, names[i-1], names[i]), ", "))
+	}
+}
+
+func runWhy(cmd *cobra.Command, args []string) error {
+	tpath := args[0]
+
+	state, err := st.LoadState(cmd.Context(), tpath, loadJobs)
+	if err != nil {
+		return fmt.Errorf("Failed to parse state: %w", err)
+	}
+	waterlog.Goodln("Successfully parsed state!")
+
+	graphData, err := buildGraph(cmd.Context(), state, depgraph.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	gi := newGraphIndex(graphData)
+	var ends [2]int
+	for i, name := range args[1:] {
+		idx, err := gi.lookup(name)
+		if err != nil {
+			return err
+		}
+		ends[i] = idx
+	}
+	if ends[0] == ends[1] {
+		return fmt.Errorf("%s and %s are the same package", args[1], args[2])
+	}
+
+	if !whyAll {
+		path, dist := graph.ShortestPath(gi.g, ends[0], ends[1])
+		if dist < 0 {
+			return fmt.Errorf("%s does not depend on %s", args[1], args[2])
+		}
+		printPath(state, gi, path)
+		return nil
+	}
+
+	paths := simplePaths(gi.g, ends[0], ends[1], whyMaxHops)
+	if len(paths) == 0 {
+		return fmt.Errorf("%s does not depend on %s in at most %d hops", args[1], args[2], whyMaxHops)
+	}
+	for pathIdx, path := range paths {
+		waterlog.Infof("Path %d:\n", pathIdx+1)
+		printPath(state, gi, path)
+	}
+	return nil
+}
@@ -5,8 +5,12 @@
 package common
 
 import (
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"slices"
@@ -14,10 +18,10 @@ import (
 
 	_ "github.com/DataDrake/waterlog"
 	"github.com/GZGavinZhao/autobuild/config"
-	"github.com/GZGavinZhao/autobuild/utils"
 	"github.com/GZGavinZhao/autobuild/ypkg"
 	"github.com/getsolus/libeopkg/index"
 	"github.com/getsolus/libeopkg/pspec"
+	"github.com/getsolus/libeopkg/shared"
 	"github.com/jwalton/gchalk"
 	"gopkg.in/yaml.v3"
 )
@@ -37,10 +41,49 @@ type Package struct {
 	Release   int
 	Provides  []string
 	BuildDeps []string
+	RunDeps   []string
 	Ignores   []string
 	Resolved  bool
 	Built     bool
 	Synced    bool
+
+	// OwnBuildDeps are the build dependencies declared by the recipe itself.
+	// BuildDeps, which the build order is solved from, has its runtime
+	// dependencies as well. For packages loaded from a manifest, which only
+	// records what they depend on, both are the same.
+	OwnBuildDeps []string
+	// Emul32Deps are the build dependencies that are only needed for the
+	// 32-bit build. They are also part of BuildDeps.
+	Emul32Deps []string
+	// CheckDeps are the build dependencies that are only needed to run the
+	// check step, i.e. those declared in `checkdeps` but not as build
+	// dependencies. They are not part of OwnBuildDeps, and their edges are
+	// marked optional. A package.yml recipe can be built without them, so
+	// they are not part of BuildDeps either. The check step of a stone.yaml
+	// recipe runs during the build, so there they are part of BuildDeps.
+	CheckDeps []string
+	// Components are the components listed in the package.yml.
+	Components []string
+	// Constraints maps the dependencies that were declared with a version
+	// constraint, e.g. `pkgconfig(foo) >= 1.2`, to that constraint. The
+	// dependencies themselves are stored without it.
+	Constraints map[string]string
+}
+
+// stripConstraints returns the dependencies without their version
+// constraints, recording the constraints in the package.
+func (p *Package) stripConstraints(deps []string) (res []string) {
+	for _, dep := range deps {
+		name, constraint := ypkg.SplitConstraint(dep)
+		if constraint != "" {
+			if p.Constraints == nil {
+				p.Constraints = make(map[string]string)
+			}
+			p.Constraints[name] = constraint
+		}
+		res = append(res, name)
+	}
+	return
 }
 
 // // Merge the info from `other` to itself. Prefer `other` if different.
@@ -110,17 +153,43 @@ func (p *Package) Resolve(nameToSrcIdx map[string]int, pkgs []Package) (res []st
 // directory. In other words, a `package.yml` file must be located at
 // `dir/package.yml`.
 func ParsePackage(dir string) (pkgs []Package, err error) {
-	// Check if the given directory contains a package definition
-	pkgFile := filepath.Join(dir, "package.yml")
-	pspecFile := filepath.Join(dir, "pspec_x86_64.xml")
-	cfgFile := filepath.Join(dir, "autobuild.yml")
+	ypkgYml, err := ypkg.Load(filepath.Join(dir, "package.yml"))
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Failed to load package.yml file for %s: %s", dir, err))
+		return
+	}
 
-	ypkgYml, err := ypkg.Load(pkgFile)
+	return parsePackage(dir, ypkgYml, os.DirFS(dir))
+}
+
+// ParsePackageFS parses a source package that is within the given `dir`
+// directory of `fsys`, in the same way as ParsePackage.
+func ParsePackageFS(fsys fs.FS, dir string) (pkgs []Package, err error) {
+	raw, err := fsys.Open(path.Join(dir, "package.yml"))
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Failed to load package.yml file for %s: %s", dir, err))
+		return
+	}
+	defer raw.Close()
+	ypkgYml, err := ypkg.Decode(raw)
 	if err != nil {
 		err = errors.New(fmt.Sprintf("Failed to load package.yml file for %s: %s", dir, err))
 		return
 	}
 
+	files, err := fs.Sub(fsys, dir)
+	if err != nil {
+		return
+	}
+	return parsePackage(dir, ypkgYml, files)
+}
+
+// parsePackage creates the package of the parsed `ypkgYml` of the recipe at
+// `dir`, whose other files are read from `files`.
+func parsePackage(dir string, ypkgYml ypkg.PackageYML, files fs.FS) (pkgs []Package, err error) {
+	pspecFile := "pspec_x86_64.xml"
+	cfgFile := "autobuild.yml"
+
 	pkgs = append(pkgs, Package{
 		Path:      dir,
 		Source:    ypkgYml.Name,
@@ -131,40 +200,35 @@ func ParsePackage(dir string) (pkgs []Package, err error) {
 		Synced:    false},
 	)
 	pkg := &pkgs[0]
+	pkg.BuildDeps = pkg.stripConstraints(pkg.BuildDeps)
+	pkg.OwnBuildDeps = slices.Clone(pkg.BuildDeps)
+	pkg.Emul32Deps = ypkgYml.Emul32BuildDeps()
+	pkg.Components = ypkgYml.Components()
 
-	// Combine the rundeps of all subpackages into a single list
-	// Note to self: this website can inspect yaml ast nodes:
-	// https://astexplorer.net/, might be useful when debugging
+	// Combine the rundeps of all subpackages into a single list. They are
+	// also considered when solving the build order.
 	rundeps := ypkgYml.RunDeps
 	if rundeps.Kind == yaml.SequenceNode {
-		for _, children := range rundeps.Content {
-			if children.Kind == yaml.ScalarNode {
-				pkg.BuildDeps = append(pkg.BuildDeps, children.Value)
-			} else if children.Kind == yaml.MappingNode {
-				for _, subpkg := range children.Content {
-					for _, rundep := range subpkg.Content {
-						if rundep.Kind != yaml.ScalarNode {
-							continue
-						}
-
-						pkg.BuildDeps = append(pkg.BuildDeps, rundep.Value)
-					}
-				}
-			}
-		}
+		pkg.RunDeps = pkg.stripConstraints(ypkgYml.CollectRunDeps())
+		pkg.BuildDeps = append(pkg.BuildDeps, pkg.RunDeps...)
 	} else {
 		err = errors.New(fmt.Sprintf("%s has unknown \"rundeps\" field kind: %s", dir, rundeps.Value))
 	}
 
 	if ypkgYml.Clang {
 		pkg.BuildDeps = append(pkg.BuildDeps, "llvm-clang-devel")
+		pkg.OwnBuildDeps = append(pkg.OwnBuildDeps, "llvm-clang-devel")
 	}
 
-	if !utils.PathExists(pspecFile) {
+	pkg.CheckDeps = slices.DeleteFunc(pkg.stripConstraints(ypkgYml.CheckDeps), func(dep string) bool {
+		return slices.Contains(pkg.OwnBuildDeps, dep)
+	})
+
+	if !fileExists(files, pspecFile) {
 		return
 	}
 
-	pspecXml, err := pspec.Load(pspecFile)
+	pspecXml, err := loadPspec(files, pspecFile)
 	if err != nil {
 		err = errors.New(fmt.Sprintf("Failed to load pspec_x86_64.xml for %s: %s", dir, err))
 		return
@@ -177,11 +241,11 @@ func ParsePackage(dir string) (pkgs []Package, err error) {
 		}
 	}
 
-	if !utils.PathExists(cfgFile) {
+	if !fileExists(files, cfgFile) {
 		return
 	}
 
-	abConfig, err := config.Load(cfgFile)
+	abConfig, err := loadConfig(files, cfgFile)
 	if err != nil {
 		err = errors.New(fmt.Sprintf("Failed to load autobuild config file for %s: %s", dir, err))
 	}
@@ -202,12 +266,43 @@ func ParsePackage(dir string) (pkgs []Package, err error) {
 	// })
 
 	slices.Sort(pkg.BuildDeps)
+	slices.Sort(pkg.OwnBuildDeps)
+	slices.Sort(pkg.Emul32Deps)
+	slices.Sort(pkg.CheckDeps)
+	slices.Sort(pkg.RunDeps)
 	slices.Sort(pkg.Provides)
 	slices.Sort(pkg.Ignores)
 
 	return
 }
 
+// fileExists reports whether `name` exists in `fsys`.
+func fileExists(fsys fs.FS, name string) bool {
+	_, err := fs.Stat(fsys, name)
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+func loadPspec(fsys fs.FS, name string) (p *pspec.PSpec, err error) {
+	raw, err := fsys.Open(name)
+	if err != nil {
+		return
+	}
+	defer raw.Close()
+
+	p = &pspec.PSpec{}
+	err = xml.NewDecoder(raw).Decode(p)
+	return
+}
+
+func loadConfig(fsys fs.FS, name string) (cfg config.AutobuildConfig, err error) {
+	raw, err := fsys.Open(name)
+	if err != nil {
+		return
+	}
+	defer raw.Close()
+	return config.Decode(raw)
+}
+
 func getPcProvides(pkg *pspec.Package) []string {
 	var provides []string
 
@@ -239,15 +334,51 @@ func getPcProvides(pkg *pspec.Package) []string {
 func ParseIndexPackage(ipkg index.Package) (pkg Package, err error) {
 	pkg.Source = ipkg.Source.Name
 	pkg.Names = append(pkg.Names, ipkg.Name)
-	pkg.Provides = append(pkg.Provides, fmt.Sprintf("name(%s)", ipkg.Name))
+	pkg.Provides = append(pkg.Provides, fmt.Sprintf("name(%s)", ipkg.Name), ipkg.Name)
+	if ipkg.Provides != nil {
+		for _, pc := range ipkg.Provides.PkgConfig {
+			pkg.Provides = append(pkg.Provides, fmt.Sprintf("pkgconfig(%s)", pc))
+		}
+		for _, pc := range ipkg.Provides.PkgConfig32 {
+			pkg.Provides = append(pkg.Provides, fmt.Sprintf("pkgconfig32(%s)", pc))
+		}
+	}
 
 	latest := ipkg.History[0]
 	pkg.Release = latest.Release
 	pkg.Version = latest.Version
 
-	// TODO: we intentionally don't add anything besides version information,
-	// because we don't need to. Right now, we only use binary index for diffing
-	// against another source/binary index to see what packages have changed.
+	// Binary packages don't record their build dependencies, only the
+	// packages they depend on at runtime.
+	if pkg.RunDeps, err = indexRunDeps(ipkg); err != nil {
+		err = fmt.Errorf("Failed to parse runtime dependencies of %s: %w", ipkg.Name, err)
+		return
+	}
+
+	slices.Sort(pkg.Provides)
+	slices.Sort(pkg.RunDeps)
+
+	return
+}
+
+// indexRunDeps returns the names of the runtime dependencies of a package in a
+// binary index.
+//
+// libeopkg decodes the whole `<RuntimeDependencies>` element as a single
+// dependency whose name is the raw inner XML, so the `<Dependency>` elements
+// have to be decoded from it here.
+func indexRunDeps(ipkg index.Package) (res []string, err error) {
+	for _, rundeps := range ipkg.RuntimeDependencies {
+		var deps struct {
+			Dependencies []shared.Dependency `xml:"Dependency"`
+		}
+		if err = xml.Unmarshal([]byte("<RuntimeDependencies>"+rundeps.Name+"</RuntimeDependencies>"), &deps); err != nil {
+			return
+		}
+		for _, dep := range deps.Dependencies {
+			res = append(res, strings.TrimSpace(dep.Name))
+		}
+	}
 
 	return
 }
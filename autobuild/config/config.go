@@ -5,6 +5,7 @@
 package config
 
 import (
+	"io"
 	"os"
 
 	"gopkg.in/yaml.v3"
@@ -21,7 +22,11 @@ func Load(path string) (cfg AutobuildConfig, err error) {
 		return
 	}
 	defer raw.Close()
-	dec := yaml.NewDecoder(raw)
-	err = dec.Decode(&cfg)
+	return Decode(raw)
+}
+
+// Decode parses an autobuild config file from `r`.
+func Decode(r io.Reader) (cfg AutobuildConfig, err error) {
+	err = yaml.NewDecoder(r).Decode(&cfg)
 	return
 }
@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package depgraph
+
+import "slices"
+
+// groupGraph is the graph between the groups of the nodes, i.e. the graph with
+// every dependency cycle collapsed into a single vertex, which is acyclic.
+type groupGraph struct {
+	// IDs of the nodes in every group, in the order of the nodes.
+	members map[int][]string
+	// Groups that every group has edges to, without duplicates.
+	deps   map[int][]int
+	depths map[int]int
+}
+
+func newGroupGraph(graphData GraphData) *groupGraph {
+	gg := &groupGraph{
+		members: make(map[int][]string),
+		deps:    make(map[int][]int),
+		depths:  make(map[int]int),
+	}
+
+	groupOf := make(map[string]int, len(graphData.Nodes))
+	for _, node := range graphData.Nodes {
+		groupOf[node.ID] = node.Group
+		gg.members[node.Group] = append(gg.members[node.Group], node.ID)
+	}
+	for _, edge := range graphData.Edges {
+		src, target := groupOf[edge.Source], groupOf[edge.Target]
+		if src != target && !slices.Contains(gg.deps[src], target) {
+			gg.deps[src] = append(gg.deps[src], target)
+		}
+	}
+	return gg
+}
+
+// depth returns the length of the longest path from `group` to a group
+// without outgoing edges.
+func (gg *groupGraph) depth(group int) int {
+	if depth, ok := gg.depths[group]; ok {
+		return depth
+	}
+	depth := 0
+	for _, dep := range gg.deps[group] {
+		depth = max(depth, gg.depth(dep)+1)
+	}
+	gg.depths[group] = depth
+	return depth
+}
+
+// LongestChain returns the longest chain of dependencies in the graph, from
+// the package that depends on the others down to one without dependencies.
+// Every dependency cycle counts as a single step of the chain containing all
+// of its members, so the chain is the critical path of building the packages
+// with unlimited parallelism. The groups of the nodes must be up to date.
+// Ties are broken in favor of the packages that come first.
+func (d GraphData) LongestChain() (chain [][]string) {
+	if len(d.Nodes) == 0 {
+		return
+	}
+	groups := newGroupGraph(d)
+
+	start := d.Nodes[0].Group
+	for _, node := range d.Nodes {
+		if groups.depth(node.Group) > groups.depth(start) {
+			start = node.Group
+		}
+	}
+
+	for group := start; ; {
+		chain = append(chain, groups.members[group])
+		next := -1
+		for _, dep := range groups.deps[group] {
+			if groups.depth(dep) == groups.depth(group)-1 && (next < 0 || dep < next) {
+				next = dep
+			}
+		}
+		if next < 0 {
+			return
+		}
+		group = next
+	}
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package depgraph
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/GZGavinZhao/autobuild/common"
+	st "github.com/GZGavinZhao/autobuild/state"
+)
+
+// edgeKey identifies the edge that dependencies are collapsed into.
+type edgeKey struct {
+	source, target, kind string
+}
+
+// edgeBuilder collects the edges of packages of a state, one per resolved
+// dependency of the kinds selected by its options.
+type edgeBuilder struct {
+	opts        Options
+	packages    []common.Package
+	pvdToPkgIdx map[string]int
+	// Every source declaring a provider, only set when needed by the options.
+	providers map[string][]string
+	ignored   map[string]bool
+
+	edges   []GraphEdge
+	edgeIdx map[edgeKey]int
+	// Number of dependencies skipped because they match opts.DropDeps.
+	dropped int
+}
+
+func newEdgeBuilder(state st.State, ignored map[string]bool, opts Options) *edgeBuilder {
+	b := &edgeBuilder{
+		opts:        opts,
+		packages:    state.Packages(),
+		pvdToPkgIdx: state.PvdToPkgIdx(),
+		ignored:     ignored,
+		edges:       make([]GraphEdge, 0),
+		edgeIdx:     make(map[edgeKey]int),
+	}
+	if opts.TraceProviders || opts.AllProviders {
+		b.providers = providerSources(state)
+	}
+	return b
+}
+
+// addPackage adds the edges of the dependencies of `pkg`.
+func (b *edgeBuilder) addPackage(pkg common.Package) {
+	if b.opts.BuildEdges {
+		b.addEdges(pkg, pkg.OwnBuildDeps, EdgeBuild)
+		if !b.opts.SkipOptional {
+			b.addEdges(pkg, pkg.CheckDeps, EdgeBuild)
+		}
+	}
+	if b.opts.RuntimeEdges {
+		b.addEdges(pkg, pkg.RunDeps, EdgeRuntime)
+	}
+}
+
+// packageEdges returns only the edges of the dependencies of `pkg`, sorted by
+// target and kind like sortGraph sorts them. The edges collected so far are
+// discarded, and the result is only valid until the next call.
+func (b *edgeBuilder) packageEdges(pkg common.Package) []GraphEdge {
+	b.edges = b.edges[:0]
+	clear(b.edgeIdx)
+	b.addPackage(pkg)
+	slices.SortStableFunc(b.edges, func(x, y GraphEdge) int {
+		if c := cmp.Compare(x.Target, y.Target); c != 0 {
+			return c
+		}
+		return cmp.Compare(x.Kind, y.Kind)
+	})
+	return b.edges
+}
+
+// addEdges adds an edge of `kind` from `pkg` to the package that each of
+// `deps` resolves to, skipping self-dependencies, unresolved dependencies and
+// dependencies on ignored packages.
+func (b *edgeBuilder) addEdges(pkg common.Package, deps []string, kind string) {
+	for _, dep := range deps {
+		if b.opts.DropDeps != nil && b.opts.DropDeps.MatchString(dep) {
+			b.dropped++
+			continue
+		}
+
+		// Resolve dependency to package index
+		depIdx, found := b.pvdToPkgIdx[dep]
+		if b.opts.TraceProviders {
+			traceProvider(pkg, dep, kind, b.packages, depIdx, found, b.providers[dep])
+		}
+		if !found {
+			// Skip dependencies that couldn't be resolved
+			continue
+		}
+
+		emul32 := kind == EdgeBuild && slices.Contains(pkg.Emul32Deps, dep)
+		if emul32 && b.opts.SkipEmul32 {
+			continue
+		}
+		optional := kind == EdgeBuild && slices.Contains(pkg.CheckDeps, dep)
+
+		depPkg := b.packages[depIdx]
+
+		// Skip self-dependencies and dependencies on ignored packages
+		if pkg.Source == depPkg.Source || b.ignored[depPkg.Source] {
+			continue
+		}
+
+		// With AllProviders, the other recipes declaring the provider
+		// get a virtual edge each
+		targets := []string{depPkg.Source}
+		if b.opts.AllProviders {
+			for _, src := range b.providers[dep] {
+				if src != pkg.Source && !b.ignored[src] && !slices.Contains(targets, src) {
+					targets = append(targets, src)
+				}
+			}
+		}
+
+		for pos, target := range targets {
+			// Add edge: pkg depends on target
+			// Direction: source → target means "source depends on target"
+			edge := GraphEdge{
+				Source:   pkg.Source,
+				Target:   target,
+				Kind:     kind,
+				Emul32:   emul32,
+				Optional: optional,
+				Virtual:  pos > 0,
+			}
+			edge.ID = EdgeID(edge)
+			// Collapse dependencies resolving to the same package
+			// into a single weighted edge. It is emul32 if any of
+			// them is, but only optional or virtual if all of them are.
+			key := edgeKey{edge.Source, edge.Target, edge.Kind}
+			idx, ok := b.edgeIdx[key]
+			if !ok {
+				idx = len(b.edges)
+				b.edgeIdx[key] = idx
+				b.edges = append(b.edges, edge)
+			}
+			b.edges[idx].Emul32 = b.edges[idx].Emul32 || edge.Emul32
+			b.edges[idx].Optional = b.edges[idx].Optional && edge.Optional
+			b.edges[idx].Virtual = b.edges[idx].Virtual && edge.Virtual
+			b.edges[idx].Weight++
+			if constraint := pkg.Constraints[dep]; constraint != "" {
+				b.edges[idx].Constraint = joinConstraint(b.edges[idx].Constraint, constraint)
+			}
+		}
+	}
+}
@@ -0,0 +1,604 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+// Package depgraph builds the dependency graph of the packages in a state, in
+// the form that is exported by the export commands.
+package depgraph
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/common"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/yourbasic/graph"
+)
+
+type GraphNode struct {
+	ID      string `json:"id" yaml:"id"`
+	IsBase  bool   `json:"isBase,omitempty" yaml:"isBase,omitempty"`
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	Release int    `json:"release,omitempty" yaml:"release,omitempty"`
+	// Component of the package; the distinct components joined by commas
+	// for split packages.
+	Component string `json:"component,omitempty" yaml:"component,omitempty"`
+	// Group is the ID of the strongly connected component of the node, so
+	// packages in the same dependency cycle share the same group.
+	Group int `json:"group" yaml:"group"`
+	// Number of edges to and from the node.
+	InDegree  int `json:"inDegree" yaml:"inDegree"`
+	OutDegree int `json:"outDegree" yaml:"outDegree"`
+	// Depth is the length of the longest chain of dependencies from
+	// the node down to a package without any, or -1 if the node is part of a
+	// dependency cycle. Cycles count as a single package for their dependents.
+	Depth int `json:"depth" yaml:"depth"`
+	// Highlighted is set on the packages selected with --highlight.
+	Highlighted bool `json:"highlighted,omitempty" yaml:"highlighted,omitempty"`
+	// Provides are the sorted providers that resolve to the package, only
+	// set with Options.IncludeProvides.
+	Provides []string `json:"provides,omitempty" yaml:"provides,omitempty"`
+	// External is set on the packages that are only part of a graph as a
+	// dependency or dependent of its other packages, see WithBoundary.
+	External bool `json:"external,omitempty" yaml:"external,omitempty"`
+}
+
+type GraphEdge struct {
+	// ID identifies the edge across exports, see EdgeID.
+	ID     string `json:"id" yaml:"id"`
+	Source string `json:"source" yaml:"source"`
+	Target string `json:"target" yaml:"target"`
+	Kind   string `json:"kind" yaml:"kind"`
+	// Weight is the number of dependency declarations that resolve to this edge.
+	Weight int `json:"weight,omitempty" yaml:"weight,omitempty"`
+	// Emul32 is set on build dependencies that are needed for the 32-bit
+	// build of the package, if any of the dependencies behind the edge is.
+	Emul32 bool `json:"emul32,omitempty" yaml:"emul32,omitempty"`
+	// Optional is set on build dependencies that are only needed to run the
+	// check step of the package, i.e. that are only declared in its
+	// `checkdeps`, if all of the dependencies behind the edge are.
+	Optional bool `json:"optional,omitempty" yaml:"optional,omitempty"`
+	// Virtual is set on the edges to the recipes that also declare the
+	// provider of a dependency, besides the one it resolves to, see
+	// Options.AllProviders, unless another dependency resolves to them.
+	Virtual bool `json:"virtual,omitempty" yaml:"virtual,omitempty"`
+	// Constraint is the version constraint of the dependencies behind the
+	// edge, e.g. ">= 1.2", joined by commas if there is more than one.
+	Constraint string `json:"constraint,omitempty" yaml:"constraint,omitempty"`
+}
+
+// SchemaVersion is the version of the shape of GraphData, GraphNode and
+// GraphEdge. It must be bumped whenever a field is added, removed or changes
+// meaning, so that consumers of the JSON export can tell them apart, and
+// graph.schema.json updated to match.
+const SchemaVersion = 11
+
+// EdgeID returns the ID of `edge`, a hash of its source, target and kind, so
+// that it stays the same across exports as long as those don't change. There
+// is at most one edge of every kind between two packages.
+func EdgeID(edge GraphEdge) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", edge.Source, edge.Target, edge.Kind)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+type GraphData struct {
+	SchemaVersion int         `json:"schemaVersion" yaml:"schemaVersion"`
+	GeneratedAt   time.Time   `json:"generatedAt" yaml:"generatedAt"`
+	Nodes         []GraphNode `json:"nodes" yaml:"nodes"`
+	Edges         []GraphEdge `json:"edges" yaml:"edges"`
+}
+
+const (
+	EdgeBuild   = "build"
+	EdgeRuntime = "runtime"
+	// EdgeInducedRuntime edges lead to the packages that the build
+	// dependencies of a package pull in at runtime, see
+	// Options.InducedRuntimeDepth.
+	EdgeInducedRuntime = "induced-runtime"
+)
+
+// Options controls which parts of a state end up in the graph built by Build.
+type Options struct {
+	BuildEdges   bool
+	RuntimeEdges bool
+	// If positive, every package also gets an EdgeInducedRuntime edge to the
+	// packages that are at most this many runtime dependencies away from one
+	// of its build dependencies, since they are installed along with them.
+	// Only build edges are followed this way.
+	InducedRuntimeDepth int
+	// Whether to drop the build dependencies that are only needed for the
+	// 32-bit build.
+	SkipEmul32 bool
+	// Whether to drop the build dependencies that are only needed to run the
+	// check step.
+	SkipOptional bool
+	// Number of package.yml files to load concurrently, GOMAXPROCS if not
+	// positive.
+	Jobs int
+	// Nodes of a previous export, which are reused for the packages whose
+	// package.yml hasn't been modified since `PreviousTime`.
+	Previous     map[string]GraphNode
+	PreviousTime time.Time
+	// Edges of the previous export, in the direction given by `Reverse`,
+	// used to warn about the packages that depended on a removed package.
+	PreviousEdges []GraphEdge
+	// Whether to log how every dependency is resolved.
+	TraceProviders bool
+	// Whether dependencies on a provider declared by several source recipes
+	// get an edge to each of them, rather than only to the one the provider
+	// resolves to. The edges to the others are marked as virtual.
+	AllProviders bool
+	// Whether to list the providers of every package in its node.
+	IncludeProvides bool
+	// Dependency declarations matching this, e.g. `^pkgconfig\(`, are
+	// skipped before they are resolved, if set.
+	DropDeps *regexp.Regexp
+	// Prefixes of the components of base packages, ignoring case, or
+	// DefaultBasePrefixes if empty.
+	BasePrefixes []string
+	// Shell-style glob patterns of the source names to leave out of the
+	// graph, along with every dependency on them, e.g. from IgnorePatterns.
+	Ignore []string
+
+	// Filters applied to the whole graph, in this order, so that dependencies
+	// are still resolved against every provider.
+	//
+	// Whether to drop base packages and every dependency on them.
+	ExcludeBase bool
+	// Only keep the packages whose component starts with any of these,
+	// ignoring case, if not empty.
+	Components []string
+	// Only keep the packages that at least this many packages depend on.
+	MinFanin int
+	// Number of times to remove the packages without dependencies, see
+	// PruneLeaves.
+	PruneLeaves int
+	// If positive and the graph has more packages than this, only keep this
+	// many of them, see SampleByFanin.
+	MaxNodes int
+	// Whether to flip the direction of every edge, so that an edge from `a`
+	// to `b` means that `b` depends on `a`.
+	Reverse bool
+}
+
+// DefaultOptions only includes build dependencies, which is what most
+// commands care about.
+var DefaultOptions = Options{BuildEdges: true}
+
+// ParseEdgeKinds turns the values of an `--edges` flag into the corresponding
+// graph options.
+func ParseEdgeKinds(kinds []string) (opts Options, err error) {
+	for _, kind := range kinds {
+		switch kind {
+		case EdgeBuild:
+			opts.BuildEdges = true
+		case EdgeRuntime:
+			opts.RuntimeEdges = true
+		case "all":
+			opts.BuildEdges = true
+			opts.RuntimeEdges = true
+		default:
+			err = fmt.Errorf("unknown edge kind %s, must be one of build, runtime or all", kind)
+			return
+		}
+	}
+	return
+}
+
+// Build builds the dependency graph of `state` according to `opts`: see
+// buildGraph for its nodes and edges, and Options for the filters applied to
+// it. Parsing the package.yml files stops early with the cause of `ctx` as the
+// error if it is cancelled.
+func Build(ctx context.Context, state st.State, opts Options) (graphData GraphData, err error) {
+	if !opts.BuildEdges && !opts.RuntimeEdges {
+		return graphData, errors.New("No dependency kinds selected")
+	}
+
+	if graphData, err = buildGraph(ctx, state, opts); err != nil {
+		return
+	}
+	return graphData.Filter(opts), nil
+}
+
+// Filter applies the filters of `opts` to the graph, in the order in which
+// they are listed in Options.
+func (d GraphData) Filter(opts Options) GraphData {
+	graphData := d
+	if opts.ExcludeBase {
+		filtered := graphData.Subgraph(func(node GraphNode) bool { return !node.IsBase })
+		waterlog.Infof("Excluded %d base packages and %d dependencies\n", len(graphData.Nodes)-len(filtered.Nodes), len(graphData.Edges)-len(filtered.Edges))
+		graphData = filtered
+	}
+	if len(opts.Components) > 0 {
+		graphData = graphData.Subgraph(func(node GraphNode) bool { return InComponents(node, opts.Components) })
+		waterlog.Infof("%d packages match the component filter\n", len(graphData.Nodes))
+	}
+	if opts.MinFanin > 0 {
+		filtered := graphData.Subgraph(func(node GraphNode) bool { return node.InDegree >= opts.MinFanin })
+		waterlog.Infof("Pruned %d packages with fewer than %d dependents\n", len(graphData.Nodes)-len(filtered.Nodes), opts.MinFanin)
+		graphData = filtered
+	}
+	if opts.PruneLeaves > 0 {
+		pruned := graphData.PruneLeaves(opts.PruneLeaves)
+		waterlog.Infof("Pruned %d leaf packages, %d packages remain\n", len(graphData.Nodes)-len(pruned.Nodes), len(pruned.Nodes))
+		graphData = pruned
+	}
+	if opts.MaxNodes > 0 && len(graphData.Nodes) > opts.MaxNodes {
+		sampled := graphData.SampleByFanin(opts.MaxNodes)
+		waterlog.Warnf("Sampled the graph down to the %d packages with the most dependents out of %d, dropping %d dependencies\n", len(sampled.Nodes), len(graphData.Nodes), len(graphData.Edges)-len(sampled.Edges))
+		graphData = sampled
+	}
+	if opts.Reverse {
+		graphData = graphData.Reversed()
+	}
+
+	return graphData
+}
+
+// hasFilters reports whether any of the filters applied by Filter is set.
+func (opts Options) hasFilters() bool {
+	return opts.ExcludeBase || len(opts.Components) > 0 || opts.MinFanin > 0 || opts.PruneLeaves > 0 || opts.MaxNodes > 0 || opts.Reverse
+}
+
+// Unfiltered returns the options without the filters applied by Filter, e.g.
+// to build a graph that can be updated with Update later on.
+func (opts Options) Unfiltered() Options {
+	opts.ExcludeBase, opts.Components = false, nil
+	opts.MinFanin, opts.PruneLeaves, opts.MaxNodes = 0, 0, 0
+	opts.Reverse = false
+	return opts
+}
+
+// buildGraph collects one node per source recipe in the state and one edge per
+// resolved dependency of the kinds selected by `opts`. An edge from `a` to `b`
+// means that `a` depends on `b`.
+func buildGraph(ctx context.Context, state st.State, opts Options) (GraphData, error) {
+	srcPkgs, ignored, sources := sourcePackages(state, opts)
+	if len(ignored) > 0 {
+		waterlog.Infof("Ignored %d packages\n", len(ignored))
+	}
+	if opts.Previous != nil {
+		warnLostDependencies(sources, opts)
+	}
+
+	// Build nodes and edges
+	nodes, err := loadNodes(ctx, srcPkgs, opts)
+	if err != nil {
+		return GraphData{}, err
+	}
+	if opts.IncludeProvides {
+		assignProvides(nodes, state)
+	}
+	builder := newEdgeBuilder(state, ignored, opts)
+	for _, pkg := range srcPkgs {
+		builder.addPackage(pkg)
+	}
+	if opts.DropDeps != nil {
+		waterlog.Infof("Dropped %d dependencies matching %s\n", builder.dropped, opts.DropDeps)
+	}
+
+	return finishGraph(state, srcPkgs, ignored, nodes, builder.edges, opts), nil
+}
+
+// sourcePackages returns the first package of every source recipe in the
+// state, except for the ones ignored by `opts`, along with the names of the
+// ignored sources and of every source.
+func sourcePackages(state st.State, opts Options) (srcPkgs []common.Package, ignored map[string]bool, sources map[string]bool) {
+	ignored = make(map[string]bool)
+	sources = make(map[string]bool)
+	for _, pkg := range state.Packages() {
+		if sources[pkg.Source] {
+			continue
+		}
+		sources[pkg.Source] = true
+		if isIgnored(pkg.Source, opts.Ignore) {
+			ignored[pkg.Source] = true
+			continue
+		}
+		srcPkgs = append(srcPkgs, pkg)
+	}
+	return
+}
+
+// finishGraph turns the nodes and edges of the `srcPkgs` of `state` into a
+// graph: the induced runtime edges selected by `opts` are added, and the
+// nodes and edges are sorted and get their groups, depths and degrees.
+func finishGraph(state st.State, srcPkgs []common.Package, ignored map[string]bool, nodes []GraphNode, edges []GraphEdge, opts Options) GraphData {
+	if opts.InducedRuntimeDepth > 0 {
+		induced := inducedRuntimeEdges(edges, runtimeTargets(srcPkgs, state.Packages(), state.PvdToPkgIdx(), ignored, opts), opts.InducedRuntimeDepth)
+		waterlog.Infof("Added %d runtime dependencies induced by build dependencies\n", len(induced))
+		edges = append(edges, induced...)
+	}
+
+	utils.RecordPeak("packages", len(nodes))
+	utils.RecordPeak("dependencies", len(edges))
+
+	graphData := GraphData{
+		SchemaVersion: SchemaVersion,
+		GeneratedAt:   time.Now().UTC(),
+		Nodes:         nodes,
+		Edges:         edges,
+	}
+	sortGraph(&graphData)
+	assignGroups(&graphData)
+	assignDepths(&graphData)
+	assignDegrees(&graphData)
+
+	return graphData
+}
+
+// sortGraph sorts the nodes by ID and the edges by source and target, so that
+// exports of the same state are identical regardless of the order in which
+// the packages have been loaded.
+func sortGraph(graphData *GraphData) {
+	slices.SortFunc(graphData.Nodes, func(a, b GraphNode) int { return cmp.Compare(a.ID, b.ID) })
+	slices.SortStableFunc(graphData.Edges, func(a, b GraphEdge) int {
+		if c := cmp.Compare(a.Source, b.Source); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Target, b.Target); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Kind, b.Kind)
+	})
+}
+
+// assignProvides sets the providers of every node to the providers that
+// resolve to a package of its source.
+func assignProvides(nodes []GraphNode, state st.State) {
+	packages := state.Packages()
+	provides := make(map[string][]string)
+	for pvd, idx := range state.PvdToPkgIdx() {
+		src := packages[idx].Source
+		provides[src] = append(provides[src], pvd)
+	}
+
+	for idx := range nodes {
+		nodes[idx].Provides = provides[nodes[idx].ID]
+		slices.Sort(nodes[idx].Provides)
+	}
+}
+
+// joinConstraint adds `constraint` to the comma-separated `constraints`,
+// unless it is already part of them.
+func joinConstraint(constraints string, constraint string) string {
+	if constraints == "" {
+		return constraint
+	}
+	if slices.Contains(strings.Split(constraints, ", "), constraint) {
+		return constraints
+	}
+	return constraints + ", " + constraint
+}
+
+// assignDegrees sets the in-degree and out-degree of every node from the edges
+// of the graph.
+func assignDegrees(graphData *GraphData) {
+	in := make(map[string]int)
+	out := make(map[string]int)
+	for _, edge := range graphData.Edges {
+		out[edge.Source]++
+		in[edge.Target]++
+	}
+
+	for idx := range graphData.Nodes {
+		graphData.Nodes[idx].InDegree = in[graphData.Nodes[idx].ID]
+		graphData.Nodes[idx].OutDegree = out[graphData.Nodes[idx].ID]
+	}
+}
+
+// providerSources returns the source names of the packages that declare every
+// provider, in the order in which they are preferred when resolving it.
+func providerSources(state st.State) map[string][]string {
+	packages := state.Packages()
+	res := make(map[string][]string)
+	for pvd, ids := range state.PvdToPkgIds() {
+		var srcs []string
+		for _, idx := range ids {
+			if !slices.Contains(srcs, packages[idx].Source) {
+				srcs = append(srcs, packages[idx].Source)
+			}
+		}
+		res[pvd] = srcs
+	}
+	return res
+}
+
+// AmbiguousProviders returns the providers that are declared by more than one
+// source recipe, mapped to the sources of those recipes in the order in which
+// they are preferred, so that the first one is the one the provider resolves
+// to.
+func AmbiguousProviders(state st.State) map[string][]string {
+	res := providerSources(state)
+	for pvd, srcs := range res {
+		if len(srcs) < 2 {
+			delete(res, pvd)
+		}
+	}
+	return res
+}
+
+// traceProvider logs how the dependency `dep` of `pkg` has been resolved. A
+// warning is logged when more than one source recipe provides it.
+func traceProvider(pkg common.Package, dep string, kind string, packages []common.Package, depIdx int, found bool, providers []string) {
+	if !found {
+		waterlog.Infof("%s: %s dependency %s -> (unresolved)\n", pkg.Source, kind, dep)
+		return
+	}
+
+	waterlog.Infof("%s: %s dependency %s -> %s\n", pkg.Source, kind, dep, packages[depIdx].Source)
+	if len(providers) > 1 {
+		waterlog.Warnf("%s: %s is provided by %s, resolved to %s\n", pkg.Source, dep, strings.Join(providers, ", "), packages[depIdx].Source)
+	}
+}
+
+// assignGroups sets the group of every node to the ID of its strongly
+// connected component. IDs are assigned in the order in which the components
+// first appear in the nodes, so that they are deterministic.
+func assignGroups(graphData *GraphData) {
+	ids := make(map[string]int, len(graphData.Nodes))
+	for idx, node := range graphData.Nodes {
+		ids[node.ID] = idx
+	}
+	g := graph.New(len(graphData.Nodes))
+	for _, edge := range graphData.Edges {
+		g.Add(ids[edge.Source], ids[edge.Target])
+	}
+
+	sccOf := make([]int, len(graphData.Nodes))
+	for sccIdx, scc := range graph.StrongComponents(g) {
+		for _, v := range scc {
+			sccOf[v] = sccIdx
+		}
+	}
+
+	groups := make(map[int]int)
+	for idx := range graphData.Nodes {
+		group, ok := groups[sccOf[idx]]
+		if !ok {
+			group = len(groups)
+			groups[sccOf[idx]] = group
+		}
+		graphData.Nodes[idx].Group = group
+	}
+}
+
+// assignDepths sets the depth of every node to the length of the longest path
+// from it to a node without outgoing edges. The groups must have been assigned
+// already: the depths are computed between groups, so that the graph of
+// groups is acyclic, and the members of cycles are marked with -1.
+func assignDepths(graphData *GraphData) {
+	groups := newGroupGraph(*graphData)
+
+	for idx := range graphData.Nodes {
+		node := &graphData.Nodes[idx]
+		if len(groups.members[node.Group]) > 1 {
+			node.Depth = -1
+			continue
+		}
+		node.Depth = groups.depth(node.Group)
+	}
+}
+
+// Subgraph returns the nodes for which `keep` returns true and the edges
+// among them.
+func (d GraphData) Subgraph(keep func(GraphNode) bool) GraphData {
+	res := GraphData{
+		SchemaVersion: d.SchemaVersion,
+		GeneratedAt:   d.GeneratedAt,
+		Nodes:         make([]GraphNode, 0),
+		Edges:         make([]GraphEdge, 0),
+	}
+
+	kept := make(map[string]bool)
+	for _, node := range d.Nodes {
+		if keep(node) {
+			kept[node.ID] = true
+			res.Nodes = append(res.Nodes, node)
+		}
+	}
+	for _, edge := range d.Edges {
+		if kept[edge.Source] && kept[edge.Target] {
+			res.Edges = append(res.Edges, edge)
+		}
+	}
+	assignDegrees(&res)
+
+	return res
+}
+
+// PruneLeaves removes the leaves of the graph, i.e. the packages that don't
+// depend on any other package, along with the edges to them, `rounds` times
+// over, so that only its more densely connected core remains. Packages whose
+// dependencies have all been removed become leaves of the next round. It
+// stops early once there are no leaves left.
+func (d GraphData) PruneLeaves(rounds int) GraphData {
+	for round := 0; round < rounds; round++ {
+		pruned := d.Subgraph(func(node GraphNode) bool { return node.OutDegree > 0 })
+		if len(pruned.Nodes) == len(d.Nodes) {
+			break
+		}
+		d = pruned
+	}
+	return d
+}
+
+// WithBoundary returns the nodes for which `keep` returns true, along with
+// their dependencies and dependents as external nodes, and the edges that
+// involve at least one of the kept nodes. Edges among external nodes are left
+// out.
+func (d GraphData) WithBoundary(keep func(GraphNode) bool) GraphData {
+	kept := make(map[string]bool)
+	for _, node := range d.Nodes {
+		if keep(node) {
+			kept[node.ID] = true
+		}
+	}
+	boundary := make(map[string]bool)
+	for _, edge := range d.Edges {
+		if kept[edge.Source] || kept[edge.Target] {
+			boundary[edge.Source] = true
+			boundary[edge.Target] = true
+		}
+	}
+
+	res := d.Subgraph(func(node GraphNode) bool { return kept[node.ID] || boundary[node.ID] })
+	res.Edges = slices.DeleteFunc(res.Edges, func(edge GraphEdge) bool {
+		return !kept[edge.Source] && !kept[edge.Target]
+	})
+	for idx := range res.Nodes {
+		res.Nodes[idx].External = !kept[res.Nodes[idx].ID]
+	}
+	assignDegrees(&res)
+
+	return res
+}
+
+// SampleByFanin returns the `n` packages with the most dependents, i.e. the
+// highest in-degree, and the edges among them. Ties are broken by source name
+// so that the same packages are always kept.
+func (d GraphData) SampleByFanin(n int) GraphData {
+	nodes := slices.Clone(d.Nodes)
+	slices.SortFunc(nodes, func(a, b GraphNode) int {
+		if a.InDegree != b.InDegree {
+			return cmp.Compare(b.InDegree, a.InDegree)
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	keep := make(map[string]bool, n)
+	for _, node := range nodes[:min(n, len(nodes))] {
+		keep[node.ID] = true
+	}
+	return d.Subgraph(func(node GraphNode) bool { return keep[node.ID] })
+}
+
+// Reversed returns the graph with the direction of every edge flipped, so
+// that an edge from `a` to `b` means that `b` depends on `a`.
+func (d GraphData) Reversed() GraphData {
+	res := GraphData{
+		SchemaVersion: d.SchemaVersion,
+		GeneratedAt:   d.GeneratedAt,
+		Nodes:         slices.Clone(d.Nodes),
+		Edges:         make([]GraphEdge, 0, len(d.Edges)),
+	}
+	for _, edge := range d.Edges {
+		edge.Source, edge.Target = edge.Target, edge.Source
+		edge.ID = EdgeID(edge)
+		res.Edges = append(res.Edges, edge)
+	}
+	sortGraph(&res)
+	assignDegrees(&res)
+
+	return res
+}
@@ -0,0 +1,334 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package depgraph
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/ypkg"
+)
+
+func TestMain(m *testing.M) {
+	// Don't leave the fixtures in the cache of the user
+	ypkg.CacheEnabled = false
+	os.Exit(m.Run())
+}
+
+// loadFixture loads the source state of the recipes in testdata/`name`.
+func loadFixture(t testing.TB, name string) st.State {
+	t.Helper()
+	return loadSource(t, filepath.Join("testdata", name))
+}
+
+// loadSource loads the source state of the recipes under `dir`.
+func loadSource(t testing.TB, dir string) st.State {
+	t.Helper()
+	state, err := st.LoadState(context.Background(), "src:"+dir)
+	if err != nil {
+		t.Fatalf("Failed to load %s: %s", dir, err)
+	}
+	return state
+}
+
+// copyFixture copies the recipes in testdata/`name` to a temporary directory,
+// so that they can be modified, and returns its path.
+func copyFixture(t testing.TB, name string) string {
+	t.Helper()
+	src := filepath.Join("testdata", name)
+	dst := t.TempDir()
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, rel), data, 0644)
+	})
+	if err != nil {
+		t.Fatalf("Failed to copy fixture %s: %s", name, err)
+	}
+	return dst
+}
+
+// writeRecipe writes a recipe named `name` to `dir` with the given package.yml.
+// Its packages are one named after it and the `extra` ones.
+func writeRecipe(t testing.TB, dir string, name string, packageYml string, extra ...string) {
+	t.Helper()
+	pspec := "<PISI>\n"
+	for _, pkg := range append([]string{name}, extra...) {
+		pspec += fmt.Sprintf("<Package><Name>%s</Name><Files>\n</Files></Package>\n", pkg)
+	}
+	pspec += "</PISI>\n"
+	if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name, "package.yml"), []byte(packageYml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name, "pspec_x86_64.xml"), []byte(pspec), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// buildFixture builds the graph of the recipes in testdata/`name`.
+func buildFixture(t testing.TB, name string, opts Options) GraphData {
+	t.Helper()
+	graphData, err := Build(context.Background(), loadFixture(t, name), opts)
+	if err != nil {
+		t.Fatalf("Failed to build the graph of fixture %s: %s", name, err)
+	}
+	return graphData
+}
+
+// edgeList describes every edge of the graph as "source -> target (kind)".
+func edgeList(graphData GraphData) (res []string) {
+	for _, edge := range graphData.Edges {
+		res = append(res, fmt.Sprintf("%s -> %s (%s)", edge.Source, edge.Target, edge.Kind))
+	}
+	return
+}
+
+func TestBuildEdgeKinds(t *testing.T) {
+	tests := []struct {
+		kinds []string
+		want  []string
+	}{
+		{[]string{"build"}, []string{"app -> lib (build)"}},
+		{[]string{"runtime"}, []string{"app -> tool (runtime)"}},
+		{[]string{"all"}, []string{"app -> lib (build)", "app -> tool (runtime)"}},
+	}
+
+	for _, tt := range tests {
+		opts, err := ParseEdgeKinds(tt.kinds)
+		if err != nil {
+			t.Fatalf("ParseEdgeKinds(%q): %s", tt.kinds, err)
+		}
+		if got := edgeList(buildFixture(t, "rundeps", opts)); !slices.Equal(got, tt.want) {
+			t.Errorf("edges with --edges %s = %q, want %q", tt.kinds, got, tt.want)
+		}
+	}
+}
+
+func TestBuildCheckDeps(t *testing.T) {
+	state := loadFixture(t, "checkdeps")
+	for _, pkg := range state.Packages() {
+		// The check step of stone.yaml recipes runs during the build
+		if want := pkg.Source == "suite"; slices.Contains(pkg.BuildDeps, "tester") != want {
+			t.Errorf("BuildDeps of %s = %q, want check dependencies: %t", pkg.Source, pkg.BuildDeps, want)
+		}
+	}
+
+	graphData, err := Build(context.Background(), state, DefaultOptions)
+	if err != nil {
+		t.Fatalf("Failed to build the graph: %s", err)
+	}
+	want := []string{"app -> lib (build)", "app -> tester (build)", "suite -> lib (build)", "suite -> tester (build)"}
+	if got := edgeList(graphData); !slices.Equal(got, want) {
+		t.Fatalf("edges = %q, want %q", got, want)
+	}
+	for _, edge := range graphData.Edges {
+		if edge.Optional != (edge.Target == "tester") {
+			t.Errorf("only the edges to tester should be optional, got %+v", edge)
+		}
+	}
+
+	opts := DefaultOptions
+	opts.SkipOptional = true
+	want = []string{"app -> lib (build)", "suite -> lib (build)"}
+	if got := edgeList(buildFixture(t, "checkdeps", opts)); !slices.Equal(got, want) {
+		t.Errorf("edges with SkipOptional = %q, want %q", got, want)
+	}
+}
+
+func TestBuildCollapsesEdges(t *testing.T) {
+	graphData := buildFixture(t, "emul32", DefaultOptions)
+	want := []string{"app -> zlib (build)", "legacy -> zlib (build)"}
+	if got := edgeList(graphData); !slices.Equal(got, want) {
+		t.Fatalf("edges = %q, want %q", got, want)
+	}
+
+	edge := graphData.Edges[0]
+	if edge.Weight != 2 || !edge.Emul32 {
+		t.Errorf("edge from pkgconfig(zlib) and pkgconfig32(zlib) = %+v, want weight 2 and emul32", edge)
+	}
+	if edge.ID != EdgeID(GraphEdge{Source: "app", Target: "zlib", Kind: EdgeBuild}) {
+		t.Errorf("ID of %+v depends on its flags", edge)
+	}
+}
+
+func TestBuildEmul32(t *testing.T) {
+	state := loadFixture(t, "emul32")
+	// legacy has no emul32 build, so it needs zlib-32bit-devel for its only build
+	wantDeps := map[string][]string{
+		"app":    {"pkgconfig32(zlib)"},
+		"legacy": nil,
+		"zlib":   nil,
+	}
+	for _, pkg := range state.Packages() {
+		if want, found := wantDeps[pkg.Source]; found && !slices.Equal(pkg.Emul32Deps, want) {
+			t.Errorf("Emul32Deps of %s = %q, want %q", pkg.Source, pkg.Emul32Deps, want)
+		}
+	}
+
+	graphData, err := Build(context.Background(), state, DefaultOptions)
+	if err != nil {
+		t.Fatalf("Failed to build the graph: %s", err)
+	}
+	for _, edge := range graphData.Edges {
+		if want := edge.Source == "app"; edge.Emul32 != want {
+			t.Errorf("edge %s -> %s has emul32 %t, want %t", edge.Source, edge.Target, edge.Emul32, want)
+		}
+	}
+
+	opts := DefaultOptions
+	opts.SkipEmul32 = true
+	graphData = buildFixture(t, "emul32", opts)
+	want := []string{"app -> zlib (build)", "legacy -> zlib (build)"}
+	if got := edgeList(graphData); !slices.Equal(got, want) {
+		t.Fatalf("edges with SkipEmul32 = %q, want %q", got, want)
+	}
+	if edge := graphData.Edges[0]; edge.Emul32 || edge.Weight != 1 {
+		t.Errorf("edge from pkgconfig(zlib) with SkipEmul32 = %+v, want weight 1 and no emul32", edge)
+	}
+}
+
+func TestSortGraphIgnoresOrder(t *testing.T) {
+	var graphData GraphData
+	for _, id := range []string{"zlib", "app", "lib", "tool", "base"} {
+		graphData.Nodes = append(graphData.Nodes, GraphNode{ID: id, Version: "1." + id})
+	}
+	edges := [][3]string{
+		{"app", "lib", EdgeBuild},
+		{"app", "lib", EdgeRuntime},
+		{"app", "lib", EdgeInducedRuntime},
+		{"app", "zlib", EdgeBuild},
+		{"lib", "zlib", EdgeRuntime},
+		{"tool", "base", EdgeBuild},
+		{"app", "tool", EdgeRuntime},
+		{"lib", "base", EdgeBuild},
+	}
+	for _, e := range edges {
+		edge := GraphEdge{Source: e[0], Target: e[1], Kind: e[2], Weight: 1}
+		edge.ID = EdgeID(edge)
+		graphData.Edges = append(graphData.Edges, edge)
+	}
+
+	want := GraphData{Nodes: slices.Clone(graphData.Nodes), Edges: slices.Clone(graphData.Edges)}
+	sortGraph(&want)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		shuffled := GraphData{Nodes: slices.Clone(graphData.Nodes), Edges: slices.Clone(graphData.Edges)}
+		rng.Shuffle(len(shuffled.Nodes), func(i, j int) { shuffled.Nodes[i], shuffled.Nodes[j] = shuffled.Nodes[j], shuffled.Nodes[i] })
+		rng.Shuffle(len(shuffled.Edges), func(i, j int) { shuffled.Edges[i], shuffled.Edges[j] = shuffled.Edges[j], shuffled.Edges[i] })
+		sortGraph(&shuffled)
+		if !reflect.DeepEqual(shuffled, want) {
+			t.Fatalf("sorted shuffled graph = %q, want %q", edgeList(shuffled), edgeList(want))
+		}
+	}
+	if got := edgeList(want)[:3]; !slices.Equal(got, []string{"app -> lib (build)", "app -> lib (induced-runtime)", "app -> lib (runtime)"}) {
+		t.Errorf("edges between the same packages = %q, want them sorted by kind", got)
+	}
+}
+
+// checkClosed fails if an edge of the graph references a node that isn't part
+// of it, or the degrees of a node don't match its edges.
+func checkClosed(t *testing.T, what string, graphData GraphData) {
+	t.Helper()
+	inDegree := make(map[string]int)
+	outDegree := make(map[string]int)
+	nodes := make(map[string]bool)
+	for _, node := range graphData.Nodes {
+		nodes[node.ID] = true
+	}
+	for _, edge := range graphData.Edges {
+		if !nodes[edge.Source] || !nodes[edge.Target] {
+			t.Errorf("%s: edge %s -> %s references a missing node", what, edge.Source, edge.Target)
+		}
+		outDegree[edge.Source]++
+		inDegree[edge.Target]++
+	}
+	for _, node := range graphData.Nodes {
+		if node.InDegree != inDegree[node.ID] || node.OutDegree != outDegree[node.ID] {
+			t.Errorf("%s: %s has degrees %d/%d, want %d/%d", what, node.ID, node.InDegree, node.OutDegree, inDegree[node.ID], outDegree[node.ID])
+		}
+	}
+}
+
+func TestFiltersKeepEdgesClosed(t *testing.T) {
+	// A random graph whose node i only depends on nodes after it, so that
+	// there are leaves to prune
+	rng := rand.New(rand.NewSource(1))
+	var graphData GraphData
+	for i := 0; i < 30; i++ {
+		graphData.Nodes = append(graphData.Nodes, GraphNode{ID: fmt.Sprintf("pkg%02d", i)})
+	}
+	for i := range graphData.Nodes {
+		for j := i + 1; j < len(graphData.Nodes); j++ {
+			if rng.Intn(6) == 0 {
+				edge := GraphEdge{Source: graphData.Nodes[i].ID, Target: graphData.Nodes[j].ID, Kind: EdgeBuild, Weight: 1}
+				edge.ID = EdgeID(edge)
+				graphData.Edges = append(graphData.Edges, edge)
+			}
+		}
+	}
+	assignDegrees(&graphData)
+	checkClosed(t, "graph", graphData)
+
+	for _, mod := range []int{2, 3, 7} {
+		sub := graphData.Subgraph(func(node GraphNode) bool { return node.ID[len(node.ID)-1]%byte(mod) != 0 })
+		checkClosed(t, fmt.Sprintf("Subgraph(mod %d)", mod), sub)
+		for rounds := 1; rounds <= 4; rounds++ {
+			checkClosed(t, fmt.Sprintf("Subgraph(mod %d).PruneLeaves(%d)", mod, rounds), sub.PruneLeaves(rounds))
+		}
+	}
+	for rounds := 1; rounds <= 4; rounds++ {
+		pruned := graphData.PruneLeaves(rounds)
+		checkClosed(t, fmt.Sprintf("PruneLeaves(%d)", rounds), pruned)
+		if len(pruned.Nodes) >= len(graphData.Nodes) {
+			t.Errorf("PruneLeaves(%d) kept all %d nodes", rounds, len(pruned.Nodes))
+		}
+	}
+	checkClosed(t, "SampleByFanin(10)", graphData.SampleByFanin(10))
+	checkClosed(t, "WithBoundary", graphData.WithBoundary(func(node GraphNode) bool { return node.ID < "pkg10" }))
+	checkClosed(t, "Filter", graphData.Filter(Options{MinFanin: 2, PruneLeaves: 2, MaxNodes: 8}))
+}
+
+func TestBuildVirtualProviders(t *testing.T) {
+	// altfoo and libfoo both provide pkgconfig(foo), which resolves to
+	// altfoo as it comes first by name
+	want := []string{"app -> altfoo (build)"}
+	if got := edgeList(buildFixture(t, "virtual", DefaultOptions)); !slices.Equal(got, want) {
+		t.Errorf("edges = %q, want %q", got, want)
+	}
+
+	opts := DefaultOptions
+	opts.AllProviders = true
+	graphData := buildFixture(t, "virtual", opts)
+	want = []string{"app -> altfoo (build)", "app -> libfoo (build)"}
+	if got := edgeList(graphData); !slices.Equal(got, want) {
+		t.Fatalf("edges with AllProviders = %q, want %q", got, want)
+	}
+	if graphData.Edges[0].Virtual || !graphData.Edges[1].Virtual {
+		t.Errorf("only the edge to libfoo should be virtual, got %+v", graphData.Edges)
+	}
+}
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package depgraph
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	st "github.com/GZGavinZhao/autobuild/state"
+)
+
+// IgnoreFile is the name of the file at the root of a source tree that lists
+// the packages to leave out of the graph.
+const IgnoreFile = ".depgraphignore"
+
+// LoadIgnoreFile reads the shell-style glob patterns in the ignore file at
+// `filename`, one per line. Empty lines and lines starting with "#" are skipped.
+func LoadIgnoreFile(filename string) (patterns []string, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err = path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("Invalid pattern %s in %s: %w", line, filename, err)
+		}
+		patterns = append(patterns, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", filename, err)
+	}
+	return
+}
+
+// IgnorePatterns returns the patterns of the ignore files at the roots of the
+// source trees that the packages of `state` have been loaded from. Trees
+// without an ignore file are skipped.
+func IgnorePatterns(state st.State) (patterns []string, err error) {
+	seen := make(map[string]bool)
+	for _, pkg := range state.Packages() {
+		if pkg.Root == "" || seen[pkg.Root] {
+			continue
+		}
+		seen[pkg.Root] = true
+
+		rootPatterns, err := LoadIgnoreFile(filepath.Join(pkg.Root, IgnoreFile))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, rootPatterns...)
+	}
+	return
+}
+
+// isIgnored reports whether the source name matches any of `patterns`.
+func isIgnored(source string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, source); matched {
+			return true
+		}
+	}
+	return false
+}
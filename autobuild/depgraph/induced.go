@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package depgraph
+
+import (
+	"github.com/GZGavinZhao/autobuild/common"
+)
+
+// runtimeTargets returns the sources of the packages that the runtime
+// dependencies of every package in `srcPkgs` resolve to, skipping
+// self-dependencies, dependencies on `ignored` packages and the ones matching
+// `opts.DropDeps`, in the same way as runtime edges.
+func runtimeTargets(srcPkgs []common.Package, packages []common.Package, pvdToPkgIdx map[string]int, ignored map[string]bool, opts Options) map[string][]string {
+	res := make(map[string][]string, len(srcPkgs))
+	for _, pkg := range srcPkgs {
+		seen := make(map[string]bool)
+		for _, dep := range pkg.RunDeps {
+			if opts.DropDeps != nil && opts.DropDeps.MatchString(dep) {
+				continue
+			}
+			depIdx, found := pvdToPkgIdx[dep]
+			if !found {
+				continue
+			}
+			target := packages[depIdx].Source
+			if target != pkg.Source && !ignored[target] && !seen[target] {
+				seen[target] = true
+				res[pkg.Source] = append(res[pkg.Source], target)
+			}
+		}
+	}
+	return res
+}
+
+// inducedRuntimeEdges returns an EdgeInducedRuntime edge from every package
+// to every package that installing its build dependencies pulls in through
+// their runtime dependencies, up to `depth` runtime dependencies away from a
+// build dependency. Packages that are build dependencies themselves, or that
+// the package itself is, get no induced edge.
+func inducedRuntimeEdges(edges []GraphEdge, runTargets map[string][]string, depth int) (res []GraphEdge) {
+	var sources []string
+	buildTargets := make(map[string][]string)
+	for _, edge := range edges {
+		if edge.Kind != EdgeBuild {
+			continue
+		}
+		if _, found := buildTargets[edge.Source]; !found {
+			sources = append(sources, edge.Source)
+		}
+		buildTargets[edge.Source] = append(buildTargets[edge.Source], edge.Target)
+	}
+
+	for _, src := range sources {
+		visited := map[string]bool{src: true}
+		for _, target := range buildTargets[src] {
+			visited[target] = true
+		}
+
+		frontier := buildTargets[src]
+		for d := 0; d < depth && len(frontier) > 0; d++ {
+			var next []string
+			for _, name := range frontier {
+				for _, target := range runTargets[name] {
+					if visited[target] {
+						continue
+					}
+					visited[target] = true
+					next = append(next, target)
+
+					edge := GraphEdge{Source: src, Target: target, Kind: EdgeInducedRuntime, Weight: 1}
+					edge.ID = EdgeID(edge)
+					res = append(res, edge)
+				}
+			}
+			frontier = next
+		}
+	}
+	return
+}
@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package depgraph
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/utils"
+	"github.com/GZGavinZhao/autobuild/ypkg"
+)
+
+// componentLabel joins the distinct components of a package.yml into a single
+// label, e.g. "system.devel" or "system.devel,system.base" for split packages.
+func componentLabel(names []string) string {
+	var res []string
+	for _, name := range names {
+		if !slices.Contains(res, name) {
+			res = append(res, name)
+		}
+	}
+	return strings.Join(res, ",")
+}
+
+// DefaultBasePrefixes are the components of the base system in Solus.
+var DefaultBasePrefixes = []string{"system.base", "system.devel"}
+
+// isBaseComponent reports whether the components of a package.yml put the
+// package (or any of its subpackages) into the base system, i.e. whether any
+// of them starts with any of `prefixes`, or DefaultBasePrefixes if empty.
+func isBaseComponent(names []string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		prefixes = DefaultBasePrefixes
+	}
+	return hasComponentPrefix(names, prefixes...)
+}
+
+// hasComponentPrefix reports whether any of the component `names` starts with
+// any of `prefixes`, ignoring case.
+func hasComponentPrefix(names []string, prefixes ...string) bool {
+	for _, name := range names {
+		val := strings.ToLower(name)
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(val, strings.ToLower(prefix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InComponents reports whether the node belongs to any of the components
+// starting with `prefixes`, in the same way as isBaseComponent.
+func InComponents(node GraphNode, prefixes []string) bool {
+	return hasComponentPrefix(strings.Split(node.Component, ","), prefixes...)
+}
+
+// newNode creates the node of a source recipe. Its metadata is loaded from the
+// package.yml of the recipe; if that fails, the metadata recorded in the
+// package itself is used, e.g. for recipes loaded from an archive.
+func newNode(pkg common.Package, opts Options) GraphNode {
+	node := GraphNode{
+		ID:        pkg.Source,
+		Version:   pkg.Version,
+		Release:   pkg.Release,
+		IsBase:    isBaseComponent(pkg.Components, opts.BasePrefixes),
+		Component: componentLabel(pkg.Components),
+	}
+
+	// Load package.yml to get component and version information
+	if pkgYml, err := ypkg.Load(pkg.Path + "/package.yml"); err == nil {
+		node.IsBase = isBaseComponent(pkgYml.Components(), opts.BasePrefixes)
+		node.Component = componentLabel(pkgYml.Components())
+		node.Version = pkgYml.Version
+		node.Release = pkgYml.Release
+	}
+
+	return node
+}
+
+// reuseNode returns the node of `pkg` from the previous export in `opts`, if
+// its package.yml hasn't been modified since.
+func reuseNode(pkg common.Package, opts Options) (GraphNode, bool) {
+	node, found := opts.Previous[pkg.Source]
+	if !found {
+		return GraphNode{}, false
+	}
+
+	info, err := os.Stat(filepath.Join(pkg.Path, "package.yml"))
+	if err != nil || info.ModTime().After(opts.PreviousTime) {
+		return GraphNode{}, false
+	}
+	// Highlights, providers and base packages depend on the flags of the
+	// export, not on the package.
+	node.Highlighted = false
+	node.Provides = nil
+	node.External = false
+	node.IsBase = isBaseComponent(strings.Split(node.Component, ","), opts.BasePrefixes)
+	return node, true
+}
+
+// warnLostDependencies warns about every package of the previous export in
+// `opts` that is still in the state, i.e. in `sources`, but depended on a
+// package that isn't anymore, as those dependencies likely can't be resolved
+// now. Their edges are gone since edges are always recomputed.
+func warnLostDependencies(sources map[string]bool, opts Options) {
+	lost := make(map[string][]string)
+	for _, edge := range opts.PreviousEdges {
+		dependent, dep := edge.Source, edge.Target
+		if opts.Reverse {
+			dependent, dep = dep, dependent
+		}
+		if sources[dep] || !sources[dependent] {
+			continue
+		}
+		if !slices.Contains(lost[dependent], dep) {
+			lost[dependent] = append(lost[dependent], dep)
+		}
+	}
+
+	dependents := make([]string, 0, len(lost))
+	for dependent := range lost {
+		dependents = append(dependents, dependent)
+	}
+	slices.Sort(dependents)
+	for _, dependent := range dependents {
+		slices.Sort(lost[dependent])
+		waterlog.Warnf("%s depended on removed package(s) %s\n", dependent, strings.Join(lost[dependent], ", "))
+	}
+}
+
+// loadNodes creates the nodes of the given packages concurrently with
+// `opts.Jobs` workers, or GOMAXPROCS workers if it is not positive. Nodes of
+// the previous export in `opts` are reused where possible. `nodes[i]` is
+// always the node of `pkgs[i]`. If `ctx` is cancelled, no more packages are
+// handed to the workers and its cause is returned once they are done.
+func loadNodes(ctx context.Context, pkgs []common.Package, opts Options) ([]GraphNode, error) {
+	defer utils.TrackPhase("parsing package.yml files")()
+
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+
+	nodes := make([]GraphNode, len(pkgs))
+	var pending []int
+	for idx, pkg := range pkgs {
+		if node, ok := reuseNode(pkg, opts); ok {
+			nodes[idx] = node
+		} else {
+			pending = append(pending, idx)
+		}
+	}
+	if opts.Previous != nil {
+		waterlog.Infof("Reusing %d of %d packages from the previous export\n", len(pkgs)-len(pending), len(pkgs))
+	}
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	progress := utils.NewProgress("Parsing package.yml files", len(pending))
+	defer progress.Finish()
+
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				nodes[idx] = newNode(pkgs[idx], opts)
+				progress.Increment()
+			}
+		}()
+	}
+	sent := 0
+feed:
+	for _, idx := range pending {
+		select {
+		case queue <- idx:
+			sent++
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		waterlog.Warnf("Stopped after parsing %d of %d package.yml files\n", sent, len(pending))
+		return nil, context.Cause(ctx)
+	}
+	return nodes, nil
+}
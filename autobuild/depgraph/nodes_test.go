@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package depgraph
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestIsBaseComponent(t *testing.T) {
+	tests := []struct {
+		names    []string
+		prefixes []string
+		want     bool
+	}{
+		{nil, nil, false},
+		{[]string{"system.base"}, nil, true},
+		{[]string{"System.Devel"}, nil, true},
+		{[]string{"programming", "system.devel"}, nil, true},
+		{[]string{"programming.tools"}, nil, false},
+		{[]string{"programming.tools"}, []string{"programming"}, true},
+		{[]string{"system.base"}, []string{"programming"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isBaseComponent(tt.names, tt.prefixes); got != tt.want {
+			t.Errorf("isBaseComponent(%q, %q) = %t, want %t", tt.names, tt.prefixes, got, tt.want)
+		}
+	}
+}
+
+// benchmarkRecipe is a package.yml of a typical size.
+const benchmarkRecipe = `name: %s
+version: 1.2.3
+release: 4
+source:
+    - https://example.com/%s-1.2.3.tar.xz : 0000000000000000000000000000000000000000000000000000000000000000
+homepage: https://example.com
+license: GPL-2.0-or-later
+component: programming.library
+summary: Benchmark package %s
+description: |
+    A package generated to benchmark parsing package.yml files.
+builddeps:
+    - pkgconfig(glib-2.0)
+    - pkgconfig(zlib)
+rundeps:
+    - devel:
+        - glib2-devel
+setup: |
+    %%meson_configure
+build: |
+    %%ninja_build
+install: |
+    %%ninja_install
+`
+
+func BenchmarkLoadNodes(b *testing.B) {
+	dir := b.TempDir()
+	for i := 0; i < 500; i++ {
+		name := fmt.Sprintf("pkg%03d", i)
+		writeRecipe(b, dir, name, fmt.Sprintf(benchmarkRecipe, name, name, name))
+	}
+	pkgs := loadSource(b, dir).Packages()
+
+	counts := []int{1, 2, 4, runtime.GOMAXPROCS(0)}
+	slices.Sort(counts)
+	for _, jobs := range slices.Compact(counts) {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			opts := DefaultOptions
+			opts.Jobs = jobs
+			for i := 0; i < b.N; i++ {
+				if _, err := loadNodes(context.Background(), pkgs, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
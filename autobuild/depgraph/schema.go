@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package depgraph
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Schema is the JSON Schema of GraphData as exported to JSON. It must be
+// updated along with SchemaVersion.
+//
+//go:embed graph.schema.json
+var Schema []byte
+
+// jsonSchema is the subset of JSON Schema used by Schema.
+type jsonSchema struct {
+	Type                 string                 `json:"type"`
+	Const                any                    `json:"const"`
+	Enum                 []any                  `json:"enum"`
+	Minimum              *json.Number           `json:"minimum"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Items                *jsonSchema            `json:"items"`
+}
+
+// decodeJSON decodes `data` keeping numbers as json.Number, so that integers
+// can be told apart from other numbers.
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// ValidateSchema validates the JSON document `data` against Schema and
+// returns every problem found, such as missing, unknown or mistyped fields,
+// prefixed with the path to the offending value. An error is only returned if
+// `data` isn't JSON at all.
+func ValidateSchema(data []byte) (problems []string, err error) {
+	var schema jsonSchema
+	if err = decodeJSON(Schema, &schema); err != nil {
+		return nil, fmt.Errorf("Failed to parse the graph schema: %w", err)
+	}
+
+	var doc any
+	if err = decodeJSON(data, &doc); err != nil {
+		return nil, fmt.Errorf("Failed to parse JSON: %w", err)
+	}
+
+	schema.validate(doc, "graph", &problems)
+	return problems, nil
+}
+
+// jsonType returns the JSON Schema type of a decoded JSON value, "integer"
+// being used for numbers without a fractional part.
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	}
+	return "null"
+}
+
+func (s *jsonSchema) validate(value any, path string, problems *[]string) {
+	if got := jsonType(value); s.Type != "" && got != s.Type && !(s.Type == "number" && got == "integer") {
+		*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", path, s.Type, got))
+		return
+	}
+
+	if s.Const != nil && !reflect.DeepEqual(value, s.Const) {
+		*problems = append(*problems, fmt.Sprintf("%s: expected %v, got %v", path, s.Const, value))
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(v any) bool { return reflect.DeepEqual(value, v) }) {
+		var allowed []string
+		for _, v := range s.Enum {
+			allowed = append(allowed, fmt.Sprint(v))
+		}
+		*problems = append(*problems, fmt.Sprintf("%s: expected one of %s, got %v", path, strings.Join(allowed, ", "), value))
+	}
+	if num, ok := value.(json.Number); ok && s.Minimum != nil {
+		minimum, _ := s.Minimum.Float64()
+		if v, _ := num.Float64(); v < minimum {
+			*problems = append(*problems, fmt.Sprintf("%s: expected at least %s, got %s", path, s.Minimum, num))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, field := range s.Required {
+			if _, ok := v[field]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s: missing required field %q", path, field))
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if prop, ok := s.Properties[key]; ok {
+				prop.validate(v[key], path+"."+key, problems)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*problems = append(*problems, fmt.Sprintf("%s: unknown field %q", path, key))
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for idx, item := range v {
+				s.Items.validate(item, fmt.Sprintf("%s[%d]", path, idx), problems)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package depgraph
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/common"
+	st "github.com/GZGavinZhao/autobuild/state"
+	"github.com/GZGavinZhao/autobuild/utils"
+)
+
+// Visitor receives the parts of a graph from Stream or GraphData.Visit: its
+// header first, then every node and then every edge, in the order of Build.
+// Visiting stops at the first error.
+type Visitor interface {
+	VisitHeader(schemaVersion int, generatedAt time.Time) error
+	VisitNode(node GraphNode) error
+	VisitEdge(edge GraphEdge) error
+}
+
+// Visit hands the graph to `v`.
+func (d GraphData) Visit(v Visitor) error {
+	if err := v.VisitHeader(d.SchemaVersion, d.GeneratedAt); err != nil {
+		return err
+	}
+	for _, node := range d.Nodes {
+		if err := v.VisitNode(node); err != nil {
+			return err
+		}
+	}
+	for _, edge := range d.Edges {
+		if err := v.VisitEdge(edge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CanStream reports whether Stream supports `opts`. The filters and the
+// induced runtime edges need the whole graph.
+func (opts Options) CanStream() bool {
+	return !opts.hasFilters() && opts.InducedRuntimeDepth <= 0
+}
+
+// Stream builds the same graph as Build, but hands it to `v` as it goes
+// instead of returning it, so that the edges of the graph are never held all
+// at once. Only the nodes and the source and target of every edge are kept,
+// to assign the groups, depths and degrees of the nodes before they are
+// visited. The edges are resolved a second time to visit them, which doesn't
+// involve any parsing.
+func Stream(ctx context.Context, state st.State, opts Options, v Visitor) error {
+	if !opts.BuildEdges && !opts.RuntimeEdges {
+		return errors.New("No dependency kinds selected")
+	}
+	if !opts.CanStream() {
+		return errors.New("Can't stream a filtered graph or induced runtime edges")
+	}
+
+	srcPkgs, ignored, sources := sourcePackages(state, opts)
+	if len(ignored) > 0 {
+		waterlog.Infof("Ignored %d packages\n", len(ignored))
+	}
+	if opts.Previous != nil {
+		warnLostDependencies(sources, opts)
+	}
+	// Visit the packages in the order in which sortGraph sorts their nodes
+	slices.SortStableFunc(srcPkgs, func(a, b common.Package) int { return cmp.Compare(a.Source, b.Source) })
+
+	nodes, err := loadNodes(ctx, srcPkgs, opts)
+	if err != nil {
+		return err
+	}
+	if opts.IncludeProvides {
+		assignProvides(nodes, state)
+	}
+
+	skeleton := GraphData{Nodes: nodes}
+	builder := newEdgeBuilder(state, ignored, opts)
+	for _, pkg := range srcPkgs {
+		for _, edge := range builder.packageEdges(pkg) {
+			skeleton.Edges = append(skeleton.Edges, GraphEdge{Source: edge.Source, Target: edge.Target})
+		}
+	}
+	if opts.DropDeps != nil {
+		waterlog.Infof("Dropped %d dependencies matching %s\n", builder.dropped, opts.DropDeps)
+	}
+	utils.RecordPeak("packages", len(nodes))
+	utils.RecordPeak("dependencies", len(skeleton.Edges))
+	assignGroups(&skeleton)
+	assignDepths(&skeleton)
+	assignDegrees(&skeleton)
+	skeleton.Edges = nil
+
+	if err = v.VisitHeader(SchemaVersion, time.Now().UTC()); err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if err = v.VisitNode(node); err != nil {
+			return err
+		}
+	}
+
+	// The providers have been traced in the first pass already
+	builder.opts.TraceProviders = false
+	for _, pkg := range srcPkgs {
+		for _, edge := range builder.packageEdges(pkg) {
+			if err = v.VisitEdge(edge); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package depgraph
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// graphCollector collects the graph it visits, failing after `limit` nodes and
+// edges if it is positive.
+type graphCollector struct {
+	graphData GraphData
+	limit     int
+}
+
+var errLimit = errors.New("limit reached")
+
+func (c *graphCollector) VisitHeader(schemaVersion int, generatedAt time.Time) error {
+	c.graphData.SchemaVersion = schemaVersion
+	c.graphData.GeneratedAt = generatedAt
+	c.graphData.Nodes = make([]GraphNode, 0)
+	c.graphData.Edges = make([]GraphEdge, 0)
+	return nil
+}
+
+func (c *graphCollector) visit() error {
+	if c.limit > 0 && len(c.graphData.Nodes)+len(c.graphData.Edges) >= c.limit {
+		return errLimit
+	}
+	return nil
+}
+
+func (c *graphCollector) VisitNode(node GraphNode) error {
+	if err := c.visit(); err != nil {
+		return err
+	}
+	c.graphData.Nodes = append(c.graphData.Nodes, node)
+	return nil
+}
+
+func (c *graphCollector) VisitEdge(edge GraphEdge) error {
+	if err := c.visit(); err != nil {
+		return err
+	}
+	c.graphData.Edges = append(c.graphData.Edges, edge)
+	return nil
+}
+
+func TestStreamMatchesBuild(t *testing.T) {
+	all, err := ParseEdgeKinds([]string{"all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withProvides := all
+	withProvides.IncludeProvides = true
+	allProviders := DefaultOptions
+	allProviders.AllProviders = true
+	noOptional := DefaultOptions
+	noOptional.SkipOptional = true
+
+	tests := []struct {
+		fixture string
+		opts    Options
+	}{
+		{"checkdeps", DefaultOptions},
+		{"checkdeps", noOptional},
+		{"emul32", DefaultOptions},
+		{"rundeps", all},
+		{"rundeps", withProvides},
+		{"virtual", allProviders},
+	}
+
+	for _, tt := range tests {
+		state := loadFixture(t, tt.fixture)
+		want, err := Build(context.Background(), state, tt.opts)
+		if err != nil {
+			t.Fatalf("Failed to build the graph of fixture %s: %s", tt.fixture, err)
+		}
+
+		var c graphCollector
+		if err = Stream(context.Background(), state, tt.opts, &c); err != nil {
+			t.Fatalf("Failed to stream the graph of fixture %s: %s", tt.fixture, err)
+		}
+		got := c.graphData
+		got.GeneratedAt = want.GeneratedAt
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("streamed graph of fixture %s = %+v, want %+v", tt.fixture, got, want)
+		}
+	}
+}
+
+func TestStreamCycles(t *testing.T) {
+	dir := t.TempDir()
+	writeRecipe(t, dir, "a", "name: a\nversion: 1\nrelease: 1\nbuilddeps:\n  - b\n")
+	writeRecipe(t, dir, "b", "name: b\nversion: 1\nrelease: 1\nbuilddeps:\n  - a\n  - c\n")
+	writeRecipe(t, dir, "c", "name: c\nversion: 1\nrelease: 1\n")
+	writeRecipe(t, dir, "d", "name: d\nversion: 1\nrelease: 1\nbuilddeps:\n  - a\n  - c\n")
+	state := loadSource(t, dir)
+
+	want, err := Build(context.Background(), state, DefaultOptions)
+	if err != nil {
+		t.Fatalf("Failed to build the graph: %s", err)
+	}
+	var c graphCollector
+	if err = Stream(context.Background(), state, DefaultOptions, &c); err != nil {
+		t.Fatalf("Failed to stream the graph: %s", err)
+	}
+	c.graphData.GeneratedAt = want.GeneratedAt
+	if !reflect.DeepEqual(c.graphData, want) {
+		t.Fatalf("streamed graph = %+v, want %+v", c.graphData, want)
+	}
+	if want.Nodes[0].Depth != -1 || want.Nodes[3].Depth != 2 {
+		t.Errorf("nodes = %+v, want a and b in a cycle and d at depth 2", want.Nodes)
+	}
+}
+
+func TestStreamStops(t *testing.T) {
+	state := loadFixture(t, "rundeps")
+	opts, err := ParseEdgeKinds([]string{"all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := graphCollector{limit: 2}
+	if err = Stream(context.Background(), state, opts, &c); !errors.Is(err, errLimit) {
+		t.Errorf("Stream() = %v, want the error of the visitor", err)
+	}
+	if n := len(c.graphData.Nodes) + len(c.graphData.Edges); n != 2 {
+		t.Errorf("visited %d nodes and edges, want to stop after 2", n)
+	}
+
+	filtered := opts
+	filtered.ExcludeBase = true
+	if err = Stream(context.Background(), state, filtered, &graphCollector{}); err == nil {
+		t.Errorf("Stream() of a filtered graph succeeded")
+	}
+}
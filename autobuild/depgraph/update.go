@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package depgraph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/GZGavinZhao/autobuild/common"
+	st "github.com/GZGavinZhao/autobuild/state"
+)
+
+// Update returns the graph of `state` given `prev`, the graph of an earlier
+// version of it built with the same options by Build or Update, and the
+// sources whose recipes have been added, modified or removed since then.
+//
+// Only the nodes of the `changed` sources are loaded again, and only the
+// edges of those and of the packages that depended or now depend on any of
+// them are resolved again; the others are reused as they are. The induced
+// runtime edges, groups, depths and degrees are computed over the whole
+// graph again, which doesn't involve any parsing.
+//
+// Since `prev` has to be the whole graph, the filters of `opts` must not be
+// set: apply them to the result with Filter instead, see Unfiltered.
+func Update(ctx context.Context, state st.State, prev GraphData, changed []string, opts Options) (GraphData, error) {
+	if !opts.BuildEdges && !opts.RuntimeEdges {
+		return GraphData{}, errors.New("No dependency kinds selected")
+	}
+	if opts.hasFilters() {
+		return GraphData{}, errors.New("Can't update a filtered graph")
+	}
+
+	isChanged := make(map[string]bool, len(changed))
+	for _, src := range changed {
+		isChanged[src] = true
+	}
+	srcPkgs, ignored, _ := sourcePackages(state, opts)
+	dirty := dirtySources(state, srcPkgs, prev, isChanged)
+
+	prevNodes := make(map[string]GraphNode, len(prev.Nodes))
+	for _, node := range prev.Nodes {
+		prevNodes[node.ID] = node
+	}
+	nodes := make([]GraphNode, len(srcPkgs))
+	var pending []common.Package
+	var pendingIdx []int
+	for idx, pkg := range srcPkgs {
+		node, found := prevNodes[pkg.Source]
+		if !found || isChanged[pkg.Source] {
+			pending = append(pending, pkg)
+			pendingIdx = append(pendingIdx, idx)
+			continue
+		}
+		nodes[idx] = node
+	}
+	opts.Previous = nil
+	loaded, err := loadNodes(ctx, pending, opts)
+	if err != nil {
+		return GraphData{}, err
+	}
+	for i, idx := range pendingIdx {
+		nodes[idx] = loaded[i]
+	}
+	if opts.IncludeProvides {
+		assignProvides(nodes, state)
+	}
+
+	edges := make([]GraphEdge, 0, len(prev.Edges))
+	for _, edge := range prev.Edges {
+		if edge.Kind != EdgeInducedRuntime && !dirty[edge.Source] {
+			edges = append(edges, edge)
+		}
+	}
+	builder := newEdgeBuilder(state, ignored, opts)
+	for _, pkg := range srcPkgs {
+		if dirty[pkg.Source] {
+			builder.addPackage(pkg)
+		}
+	}
+	edges = append(edges, builder.edges...)
+
+	return finishGraph(state, srcPkgs, ignored, nodes, edges, opts), nil
+}
+
+// dirtySources returns the sources among `srcPkgs` whose edges may differ
+// from the ones in `prev` because of the `changed` sources: those themselves,
+// the ones that had an edge to any of them, and the ones with a dependency
+// that any of them provides now.
+func dirtySources(state st.State, srcPkgs []common.Package, prev GraphData, changed map[string]bool) map[string]bool {
+	dirty := make(map[string]bool)
+	for src := range changed {
+		dirty[src] = true
+	}
+	for _, edge := range prev.Edges {
+		if changed[edge.Target] {
+			dirty[edge.Source] = true
+		}
+	}
+
+	packages := state.Packages()
+	pvdToPkgIds := state.PvdToPkgIds()
+	providedByChanged := func(deps []string) bool {
+		for _, dep := range deps {
+			for _, idx := range pvdToPkgIds[dep] {
+				if changed[packages[idx].Source] {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, pkg := range srcPkgs {
+		if !dirty[pkg.Source] && (providedByChanged(pkg.OwnBuildDeps) || providedByChanged(pkg.CheckDeps) || providedByChanged(pkg.RunDeps)) {
+			dirty[pkg.Source] = true
+		}
+	}
+	return dirty
+}
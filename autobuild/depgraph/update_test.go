@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package depgraph
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name string
+		// edit modifies the recipes in `dir` and returns the changed sources
+		edit func(t *testing.T, dir string) []string
+		opts Options
+	}{
+		{"modified recipe", func(t *testing.T, dir string) []string {
+			writeRecipe(t, dir, "app", "name: app\nversion: 1.1\nrelease: 2\ncomponent: programming.tools\nbuilddeps:\n  - lib-devel\nrundeps:\n  - lib\n  - tool\n")
+			return []string{"app"}
+		}, Options{BuildEdges: true, RuntimeEdges: true}},
+		{"new dependent", func(t *testing.T, dir string) []string {
+			writeRecipe(t, dir, "helper", "name: helper\nversion: 1\nrelease: 1\ncomponent: system.utils\nbuilddeps:\n  - app\n")
+			return []string{"helper"}
+		}, DefaultOptions},
+		{"removed dependency", func(t *testing.T, dir string) []string {
+			if err := os.RemoveAll(filepath.Join(dir, "lib")); err != nil {
+				t.Fatal(err)
+			}
+			return []string{"lib"}
+		}, DefaultOptions},
+		{"new provider", func(t *testing.T, dir string) []string {
+			writeRecipe(t, dir, "libnew", "name: libnew\nversion: 1\nrelease: 1\ncomponent: system.utils\n", "lib-devel")
+			return []string{"libnew"}
+		}, Options{BuildEdges: true, AllProviders: true, InducedRuntimeDepth: 2, IncludeProvides: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := copyFixture(t, "rundeps")
+			prev, err := Build(context.Background(), loadSource(t, dir), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			changed := tt.edit(t, dir)
+			state := loadSource(t, dir)
+			got, err := Update(context.Background(), state, prev, changed, tt.opts)
+			if err != nil {
+				t.Fatalf("Update: %s", err)
+			}
+			want, err := Build(context.Background(), state, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got.GeneratedAt, want.GeneratedAt = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Update = %+v\nwant the same as Build: %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateFiltered(t *testing.T) {
+	opts := DefaultOptions
+	opts.ExcludeBase = true
+	if _, err := Update(context.Background(), loadFixture(t, "rundeps"), GraphData{}, nil, opts); err == nil {
+		t.Error("Update with a filter succeeded")
+	}
+}
@@ -11,7 +11,9 @@ require (
 	github.com/deckarep/golang-set/v2 v2.6.0
 	github.com/dominikbraun/graph v0.23.0
 	github.com/fatih/color v1.16.0
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/getsolus/libeopkg v0.1.1-0.20230924201845-7f2598d34467
+	github.com/jwalton/gchalk v1.3.0
 	github.com/serpent-os/libstone-go v0.0.0-20240610023118-0ce587b36585
 	github.com/spf13/cobra v1.8.0
 	github.com/yourbasic/graph v0.0.0-20210606180040-8ecfec1c2869
@@ -20,7 +22,6 @@ require (
 )
 
 require (
-	github.com/jwalton/gchalk v1.3.0 // indirect
 	github.com/jwalton/go-supportscolor v1.1.0 // indirect
 	github.com/klauspost/compress v1.17.6 // indirect
 	github.com/klauspost/cpuid/v2 v2.0.12 // indirect
@@ -5,9 +5,11 @@
 package main
 
 import (
+	"os"
+
 	"github.com/GZGavinZhao/autobuild/cmd"
 )
 
 func main() {
-	cmd.Execute()
+	os.Exit(cmd.Execute())
 }
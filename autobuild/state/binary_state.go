@@ -5,9 +5,15 @@
 package state
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/GZGavinZhao/autobuild/common"
 	"github.com/getsolus/libeopkg/index"
@@ -18,6 +24,7 @@ import (
 type BinaryState struct {
 	packages    []common.Package
 	pvdToPkgIdx map[string]int
+	pvdToPkgIds map[string][]int
 	srcToPkgIds map[string][]int
 	depGraph    *graph.Immutable
 	isGit       bool
@@ -35,6 +42,10 @@ func (s *BinaryState) PvdToPkgIdx() map[string]int {
 	return s.pvdToPkgIdx
 }
 
+func (s *BinaryState) PvdToPkgIds() map[string][]int {
+	return s.pvdToPkgIds
+}
+
 func (s *BinaryState) DepGraph() *graph.Immutable {
 	return s.depGraph
 }
@@ -48,14 +59,14 @@ func LoadEopkgIndex(i *index.Index) (state *BinaryState, err error) {
 
 	state = &BinaryState{}
 	state.packages = make([]common.Package, len(i.Packages))
-	state.pvdToPkgIdx = make(map[string]int)
 	state.srcToPkgIds = make(map[string][]int)
+	names := make(map[string]int)
 
 	// Iterate through the eopkg index and check if there are version/release
 	// discrepancies between the source repository and the binary index.
 	for idx, ipkg := range i.Packages {
 		pvd := fmt.Sprintf("name(%s)", ipkg.Name)
-		if ext, ok := state.pvdToPkgIdx[pvd]; ok {
+		if ext, ok := names[pvd]; ok {
 			err = fmt.Errorf("Duplicate provider %s, %s provides but already provided by %s", pvd, ipkg.Name, state.packages[ext].Show(true, false))
 			return
 		}
@@ -66,46 +77,89 @@ func LoadEopkgIndex(i *index.Index) (state *BinaryState, err error) {
 			return
 		}
 
-		state.pvdToPkgIdx[pvd] = idx
+		names[pvd] = idx
 		state.srcToPkgIds[ipkg.Source.Name] = append(state.srcToPkgIds[ipkg.Source.Name], idx)
 		state.packages[idx] = pkg
 	}
+	state.pvdToPkgIdx, state.pvdToPkgIds = resolveProviders(state.packages)
 
 	return
 }
 
-func LoadBinary(path string) (state *BinaryState, err error) {
-	eopkgIndex, err := index.Load(path)
+// openIndex opens the eopkg index at `path`, which is either a local file or
+// an HTTP(S) URL. Indices ending with `.xz` or `.gz` are decompressed
+// transparently.
+func openIndex(ctx context.Context, path string) (r io.ReadCloser, err error) {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, path, nil); err != nil {
+			return
+		}
+		var resp *http.Response
+		if resp, err = http.DefaultClient.Do(req); err != nil {
+			err = fmt.Errorf("Failed to fetch binary index from url %s: %w", path, err)
+			return
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			err = fmt.Errorf("Failed to fetch binary index from url %s: %s", path, resp.Status)
+			return
+		}
+		r = resp.Body
+	} else if r, err = os.Open(path); err != nil {
+		return
+	}
+
+	var dr io.Reader
+	switch filepath.Ext(path) {
+	case ".xz":
+		dr, err = xz.NewReader(r)
+	case ".gz":
+		dr, err = gzip.NewReader(r)
+	default:
+		return
+	}
 	if err != nil {
+		r.Close()
+		err = fmt.Errorf("Failed to decompress binary index %s: %w", path, err)
 		return
 	}
 
-	state, err = LoadEopkgIndex(eopkgIndex)
+	r = readCloser{dr, r}
 	return
 }
 
-func LoadEopkgRepo(name string) (state *BinaryState, err error) {
-	indexUrl := fmt.Sprintf("https://packages.getsol.us/%s/eopkg-index.xml.xz", name)
-	resp, err := http.Get(indexUrl)
-	if err != nil {
-		err = fmt.Errorf("Failed to fetch binary index from url %s: %w", indexUrl, err)
-		return
-	}
+// readCloser reads from a decompressing reader and closes the underlying
+// file or response body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
 
-	r, err := xz.NewReader(resp.Body)
+// LoadBinary loads the eopkg index at `path`, which may be a local file or an
+// HTTP(S) URL, optionally compressed with xz or gzip. Fetching it from a URL
+// is aborted if `ctx` is cancelled.
+func LoadBinary(ctx context.Context, path string) (state *BinaryState, err error) {
+	r, err := openIndex(ctx, path)
 	if err != nil {
-		err = fmt.Errorf("Failed to create XZ reader with binary index from url %s: %w", indexUrl, err)
 		return
 	}
+	defer r.Close()
 
-	dec := xml.NewDecoder(r)
 	var i index.Index
-	err = dec.Decode(&i)
-	if err != nil {
-		err = fmt.Errorf("Failed to decode binary index from url %s: %w", indexUrl, err)
+	if err = xml.NewDecoder(r).Decode(&i); err != nil {
+		if ctx.Err() != nil {
+			err = context.Cause(ctx)
+		}
+		err = fmt.Errorf("Failed to decode binary index %s: %w", path, err)
 		return
 	}
 
 	state, err = LoadEopkgIndex(&i)
 	return
 }
+
+func LoadEopkgRepo(ctx context.Context, name string) (state *BinaryState, err error) {
+	indexUrl := fmt.Sprintf("https://packages.getsol.us/%s/eopkg-index.xml.xz", name)
+	return LoadBinary(ctx, indexUrl)
+}
@@ -4,6 +4,13 @@
 
 package state
 
+import (
+	"slices"
+	"strings"
+
+	"github.com/GZGavinZhao/autobuild/utils"
+)
+
 type Diff struct {
 	Idx       int
 	OldIdx    int
@@ -32,3 +39,74 @@ func (d Diff) IsUpdate() bool {
 func (d Diff) IsDowngrade() bool {
 	return d.RelNum < d.OldRelNum
 }
+
+// DepsDiff describes how the build dependencies of a source recipe changed
+// between two states.
+type DepsDiff struct {
+	Source  string   `json:"source"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// sourceBuildDeps returns the sorted build dependencies of every source recipe
+// in the state, combined over all of its packages.
+func sourceBuildDeps(s State) map[string][]string {
+	res := make(map[string][]string)
+	for src, ids := range s.SrcToPkgIds() {
+		var deps []string
+		for _, idx := range ids {
+			deps = append(deps, s.Packages()[idx].BuildDeps...)
+		}
+		slices.Sort(deps)
+		res[src] = utils.Uniq2(deps)
+	}
+	return res
+}
+
+// Added returns the sorted source recipes that are in `cur` but not in `old`.
+func Added(old *State, cur *State) (res []string) {
+	for src := range (*cur).SrcToPkgIds() {
+		if _, found := (*old).SrcToPkgIds()[src]; !found {
+			res = append(res, src)
+		}
+	}
+	slices.Sort(res)
+	return
+}
+
+// Removed returns the sorted source recipes that are in `old` but not in `cur`.
+func Removed(old *State, cur *State) []string {
+	return Added(cur, old)
+}
+
+// DepsChanged compares the build dependencies of every source recipe that is
+// in both states, and returns the recipes whose build dependencies differ,
+// sorted by name.
+func DepsChanged(old *State, cur *State) (res []DepsDiff) {
+	oldDeps := sourceBuildDeps(*old)
+	for src, deps := range sourceBuildDeps(*cur) {
+		prev, found := oldDeps[src]
+		if !found {
+			continue
+		}
+
+		diff := DepsDiff{Source: src}
+		for _, dep := range deps {
+			if _, found := slices.BinarySearch(prev, dep); !found {
+				diff.Added = append(diff.Added, dep)
+			}
+		}
+		for _, dep := range prev {
+			if _, found := slices.BinarySearch(deps, dep); !found {
+				diff.Removed = append(diff.Removed, dep)
+			}
+		}
+
+		if len(diff.Added) > 0 || len(diff.Removed) > 0 {
+			res = append(res, diff)
+		}
+	}
+
+	slices.SortFunc(res, func(a, b DepsDiff) int { return strings.Compare(a.Source, b.Source) })
+	return
+}
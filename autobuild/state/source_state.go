@@ -6,6 +6,7 @@ package state
 
 import (
 	"cmp"
+	"context"
 	"fmt"
 	"io/fs"
 	"path/filepath"
@@ -21,14 +22,13 @@ import (
 	"github.com/yourbasic/graph"
 )
 
-var (
-	badPackages = [...]string{"haskell-http-client-tls"}
-)
+var badPackages = [...]string{"haskell-http-client-tls"}
 
 type SourceState struct {
 	packages    []common.Package
 	depGraph    *graph.Immutable
 	pvdToPkgIdx map[string]int
+	pvdToPkgIds map[string][]int
 	srcToPkgIds map[string][]int
 	isGit       bool
 }
@@ -49,6 +49,10 @@ func (s *SourceState) PvdToPkgIdx() map[string]int {
 	return s.pvdToPkgIdx
 }
 
+func (s *SourceState) PvdToPkgIds() map[string][]int {
+	return s.pvdToPkgIds
+}
+
 func (s *SourceState) IsGit() bool {
 	return s.isGit
 }
@@ -81,7 +85,11 @@ func (s *SourceState) buildGraph() {
 	s.depGraph = graph.Sort(g)
 }
 
-func LoadSource(path string) (state *SourceState, err error) {
+// LoadSource loads the recipes under `path`, parsing `jobs` recipe directories
+// concurrently, or a number based on the number of CPUs if it is not
+// positive. It stops early with the cause of `ctx` as the error if it is
+// cancelled.
+func LoadSource(ctx context.Context, path string, jobs int) (state *SourceState, err error) {
 	state = &SourceState{}
 	state.pvdToPkgIdx = make(map[string]int)
 	state.srcToPkgIds = make(map[string][]int)
@@ -90,14 +98,22 @@ func LoadSource(path string) (state *SourceState, err error) {
 		state.isGit = true
 	}
 
+	// The walk function runs concurrently on the workers, but the packages
+	// are sorted by index() afterwards, so their order doesn't depend on it.
 	walkConf := fastwalk.Config{
-		Follow: false,
+		Follow:     false,
+		NumWorkers: jobs,
 	}
 	_ = walkConf
 	var mutex sync.Mutex
+	progress := utils.NewProgress("Loading recipes", 0)
+	defer progress.Finish()
 
 	// err = filepath.WalkDir(path, func(pkgpath string, d fs.DirEntry, err error) error {
 	err = fastwalk.Walk(&walkConf, path, func(pkgpath string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
 		if !d.IsDir() {
 			return nil
 		}
@@ -150,48 +166,131 @@ func LoadSource(path string) (state *SourceState, err error) {
 		mutex.Lock()
 		state.packages = append(state.packages, pkgs...)
 		mutex.Unlock()
+		progress.Increment()
 
 		return filepath.SkipDir
 	})
 
 	if err != nil {
+		if ctx.Err() != nil {
+			waterlog.Warnf("Stopped after loading %d packages\n", len(state.packages))
+		}
 		return
 	}
 
-	slices.SortFunc(state.packages, func(a, b common.Package) int {
+	state.index()
+	return
+}
+
+// index sorts the packages and builds the lookup tables and the dependency
+// graph from them.
+func (s *SourceState) index() {
+	slices.SortFunc(s.packages, func(a, b common.Package) int {
 		if a.Source == b.Source {
 			// If we want to be really precise, we should compare the entire
 			// `Names` slice, but just comparing the first element should be
-			// enough.
+			// enough. Duplicate recipes are ordered by their path, since
+			// the order in which they are loaded isn't deterministic.
+			if a.Names[0] == b.Names[0] {
+				return cmp.Compare(a.Path, b.Path)
+			}
 			return cmp.Compare(a.Names[0], b.Names[0])
 		} else {
 			return cmp.Compare(a.Source, b.Source)
 		}
 	})
 
-	for idx, pkg := range state.packages {
-		state.srcToPkgIds[pkg.Source] = append(state.srcToPkgIds[pkg.Source], idx)
+	for idx, pkg := range s.packages {
+		s.srcToPkgIds[pkg.Source] = append(s.srcToPkgIds[pkg.Source], idx)
 
 		// for _, pvd := range pkg.Names {
-		// 	if nidx, ok := state.pvdToPkgIdx[pvd]; ok && nidx != idx {
-		// 		waterlog.Errorf("Duplicate provider for %s from %s, currently %s\n", pvd, pkg.Source, state.packages[nidx].Source)
+		// 	if nidx, ok := s.pvdToPkgIdx[pvd]; ok && nidx != idx {
+		// 		waterlog.Errorf("Duplicate provider for %s from %s, currently %s\n", pvd, pkg.Source, s.packages[nidx].Source)
 		// 	}
-		// 	state.pvdToPkgIdx[pvd] = idx
+		// 	s.pvdToPkgIdx[pvd] = idx
 		// }
-		for _, pvd := range pkg.Provides {
-			if pidx, ok := state.pvdToPkgIdx[pvd]; ok && pidx != idx {
-				waterlog.Errorf("Duplicate provider for %s from %s, currently %s\n", pvd, pkg.Show(true, false), state.packages[pidx].Show(true, false))
-			}
-			state.pvdToPkgIdx[pvd] = idx
-		}
 	}
+	s.pvdToPkgIdx, s.pvdToPkgIds = resolveProviders(s.packages)
 
-	for idx := range state.packages {
-		state.packages[idx].Resolve(state.pvdToPkgIdx, state.packages)
+	for idx := range s.packages {
+		s.packages[idx].Resolve(s.pvdToPkgIdx, s.packages)
 		// fmt.Printf("%d %s: %q\n", idx, state.Packages[idx].Name, state.Packages[idx].BuildDeps)
 	}
 
 	// fmt.Println("result:", state)
-	state.buildGraph()
+	s.buildGraph()
+}
+
+// Reload returns a copy of the state with the recipes in `dirs` under `root`
+// parsed again, e.g. after their package.yml has been modified. Directories
+// that no longer contain a package.yml are dropped from the state, and new ones
+// are added to it. The state itself is left untouched.
+func (s *SourceState) Reload(root string, dirs []string) (state *SourceState, err error) {
+	state = &SourceState{isGit: s.isGit}
+	state.pvdToPkgIdx = make(map[string]int)
+	state.srcToPkgIds = make(map[string][]int)
+
+	reloaded := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		reloaded[filepath.Clean(dir)] = true
+	}
+	for _, pkg := range s.packages {
+		if !reloaded[filepath.Clean(pkg.Path)] {
+			state.packages = append(state.packages, pkg)
+		}
+	}
+
+	for _, dir := range dirs {
+		if !utils.PathExists(filepath.Join(dir, "package.yml")) {
+			continue
+		}
+		pkgs, err := common.ParsePackage(dir)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: %w", filepath.Join(dir, "package.yml"), err)
+		}
+		for i := range pkgs {
+			pkgs[i].Root = root
+		}
+		state.packages = append(state.packages, pkgs...)
+	}
+
+	state.index()
 	return
 }
+
+// MergeSources combines the source states into a single state, e.g. when the
+// recipes are split across multiple repositories. States are merged in order:
+// when more than one state has a recipe with the same source name, the recipe
+// from the later state overrides those from the earlier ones and a warning is
+// logged. Providers are resolved across all the merged states.
+func MergeSources(states []*SourceState) *SourceState {
+	merged := &SourceState{}
+	merged.pvdToPkgIdx = make(map[string]int)
+	merged.srcToPkgIds = make(map[string][]int)
+
+	// Index of the state that has the final say on every source, and the path
+	// of its recipe
+	owner := make(map[string]int)
+	ownerPath := make(map[string]string)
+	for stateIdx, state := range states {
+		for _, pkg := range state.packages {
+			if prev, ok := owner[pkg.Source]; ok && prev != stateIdx {
+				waterlog.Warnf("Source %s at %s overrides the one at %s\n", pkg.Source, pkg.Path, ownerPath[pkg.Source])
+			}
+			owner[pkg.Source] = stateIdx
+			ownerPath[pkg.Source] = pkg.Path
+		}
+		merged.isGit = merged.isGit || state.isGit
+	}
+
+	for stateIdx, state := range states {
+		for _, pkg := range state.packages {
+			if owner[pkg.Source] == stateIdx {
+				merged.packages = append(merged.packages, pkg)
+			}
+		}
+	}
+
+	merged.index()
+	return merged
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package state
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/GZGavinZhao/autobuild/common"
+)
+
+// testPackage returns a recipe named `source` at `version` that provides its
+// own name.
+func testPackage(source, version string, buildDeps ...string) common.Package {
+	return common.Package{
+		Path:      source + "-" + version,
+		Names:     []string{source},
+		Source:    source,
+		Version:   version,
+		Provides:  []string{source},
+		BuildDeps: buildDeps,
+	}
+}
+
+func TestMergeSources(t *testing.T) {
+	tests := []struct {
+		name   string
+		states [][]common.Package
+		want   []string
+	}{
+		{
+			name:   "single state",
+			states: [][]common.Package{{testPackage("foo", "1"), testPackage("bar", "1")}},
+			want:   []string{"bar-1", "foo-1"},
+		},
+		{
+			name: "disjoint states",
+			states: [][]common.Package{
+				{testPackage("foo", "1")},
+				{testPackage("bar", "2")},
+			},
+			want: []string{"bar-2", "foo-1"},
+		},
+		{
+			name: "later state overrides",
+			states: [][]common.Package{
+				{testPackage("foo", "1"), testPackage("bar", "1")},
+				{testPackage("foo", "2")},
+			},
+			want: []string{"bar-1", "foo-2"},
+		},
+		{
+			name: "last state wins",
+			states: [][]common.Package{
+				{testPackage("foo", "1")},
+				{testPackage("foo", "2"), testPackage("bar", "2")},
+				{testPackage("foo", "3")},
+			},
+			want: []string{"bar-2", "foo-3"},
+		},
+		{
+			name: "earlier state does not override",
+			states: [][]common.Package{
+				{testPackage("foo", "1")},
+				{testPackage("foo", "2")},
+				{testPackage("bar", "3")},
+			},
+			want: []string{"bar-3", "foo-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var states []*SourceState
+			for _, pkgs := range tt.states {
+				states = append(states, &SourceState{packages: slices.Clone(pkgs)})
+			}
+
+			merged := MergeSources(states)
+			var got []string
+			for _, pkg := range merged.Packages() {
+				got = append(got, pkg.Path)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("MergeSources() = %v, want %v", got, tt.want)
+			}
+
+			// Providers must resolve to the recipe that won
+			for idx, pkg := range merged.Packages() {
+				if pvdIdx := merged.PvdToPkgIdx()[pkg.Source]; pvdIdx != idx {
+					t.Errorf("provider %s resolves to %s, want %s", pkg.Source, merged.Packages()[pvdIdx].Path, pkg.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeSourcesProviders(t *testing.T) {
+	// bar only depends on foo through the state that overrides it
+	merged := MergeSources([]*SourceState{
+		{packages: []common.Package{testPackage("foo", "1"), testPackage("bar", "1", "foo")}},
+		{packages: []common.Package{testPackage("foo", "2")}},
+	})
+
+	fooIdx := merged.SrcToPkgIds()["foo"]
+	barIdx := merged.SrcToPkgIds()["bar"]
+	if len(fooIdx) != 1 || len(barIdx) != 1 {
+		t.Fatalf("merged state has recipes %v, want exactly one foo and one bar", merged.SrcToPkgIds())
+	}
+	if merged.Packages()[fooIdx[0]].Version != "2" {
+		t.Errorf("foo has version %s, want 2", merged.Packages()[fooIdx[0]].Version)
+	}
+	if !merged.DepGraph().Edge(fooIdx[0], barIdx[0]) {
+		t.Errorf("bar does not depend on the overriding foo")
+	}
+}
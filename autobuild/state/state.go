@@ -5,6 +5,8 @@
 package state
 
 import (
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"slices"
@@ -24,6 +26,9 @@ type State interface {
 	Packages() []common.Package
 	SrcToPkgIds() map[string][]int
 	PvdToPkgIdx() map[string]int
+	// PvdToPkgIds maps every provider to all the packages that declare it,
+	// the first one being the one it resolves to in PvdToPkgIdx.
+	PvdToPkgIds() map[string][]int
 	DepGraph() *graph.Immutable
 	// GetPackage(string) (common.Package, int)
 	// GetPackageIdx(string) int
@@ -52,31 +57,139 @@ func PackageExists(s State, pvd string) bool {
 	return ok
 }
 
+// providerName returns the name wrapped by a provider such as
+// `pkgconfig(name)`, or the provider itself if it doesn't wrap anything.
+func providerName(pvd string) string {
+	if start := strings.IndexByte(pvd, '('); start >= 0 && strings.HasSuffix(pvd, ")") {
+		return pvd[start+1 : len(pvd)-1]
+	}
+	return pvd
+}
+
+// resolveProviders maps every provider declared by `packages` to the indices
+// of the packages that declare it, and to the one it resolves to.
+//
+// When more than one package declares a provider, the choice doesn't depend on
+// the order of `packages`: packages whose source name is the provider name
+// (with `pkgconfig()` and similar wrappers removed) are preferred, then
+// packages are compared by source name and then by package name. Only the
+// number of such providers is logged, unless debug output is enabled.
+func resolveProviders(packages []common.Package) (pvdToPkgIdx map[string]int, pvdToPkgIds map[string][]int) {
+	pvdToPkgIdx = make(map[string]int)
+	pvdToPkgIds = make(map[string][]int)
+	for idx, pkg := range packages {
+		for _, pvd := range pkg.Provides {
+			if ids := pvdToPkgIds[pvd]; len(ids) == 0 || ids[len(ids)-1] != idx {
+				pvdToPkgIds[pvd] = append(ids, idx)
+			}
+		}
+	}
+
+	pvds := make([]string, 0, len(pvdToPkgIds))
+	for pvd := range pvdToPkgIds {
+		pvds = append(pvds, pvd)
+	}
+	slices.Sort(pvds)
+
+	duplicates := 0
+	for _, pvd := range pvds {
+		ids := pvdToPkgIds[pvd]
+		if len(ids) > 1 {
+			duplicates++
+			name := providerName(pvd)
+			slices.SortFunc(ids, func(a, b int) int {
+				pa, pb := packages[a], packages[b]
+				if ma, mb := pa.Source == name, pb.Source == name; ma != mb {
+					if ma {
+						return -1
+					}
+					return 1
+				}
+				if c := cmp.Compare(pa.Source, pb.Source); c != 0 {
+					return c
+				}
+				return cmp.Compare(pa.Names[0], pb.Names[0])
+			})
+
+			var others []string
+			for _, idx := range ids[1:] {
+				others = append(others, packages[idx].Show(true, false))
+			}
+			waterlog.Debugf("Duplicate provider for %s from %s, using %s\n", pvd, strings.Join(others, ", "), packages[ids[0]].Show(true, false))
+		}
+		pvdToPkgIdx[pvd] = ids[0]
+	}
+	if duplicates > 0 {
+		waterlog.Warnf("%d providers are declared by more than one package, pass --verbose to list them\n", duplicates)
+	}
+
+	return
+}
+
 func ValidTPath(tpath string) bool {
-	splitted := strings.Split(tpath, ":")
+	// Only split on the first colon, since the path may be a URL
+	splitted := strings.SplitN(tpath, ":", 2)
 
-	if len(splitted) > 2 {
+	if len(splitted) != 2 {
 		return false
 	}
 
-	return slices.Contains([]string{"src", "bin", "repo"}, splitted[0])
+	return slices.Contains([]string{"src", "bin", "repo", "tar"}, splitted[0])
 }
 
-func LoadState(tpath string) (state State, err error) {
+// LoadState loads the state at `tpath`. Loading stops early with the cause of
+// `ctx` as the error if it is cancelled. A source tree is parsed with the
+// number of concurrent jobs given by the optional `jobs`, see LoadSource.
+func LoadState(ctx context.Context, tpath string, jobs ...int) (state State, err error) {
+	defer utils.TrackPhase("loading states")()
+
 	if !ValidTPath(tpath) {
 		err = InvalidTPathError
 		return
 	}
 
-	splitted := strings.Split(tpath, ":")
+	splitted := strings.SplitN(tpath, ":", 2)
 	if splitted[0] == "src" {
-		state, err = LoadSource(splitted[1])
+		n := 0
+		if len(jobs) > 0 {
+			n = jobs[0]
+		}
+		state, err = LoadSource(ctx, splitted[1], n)
+	} else if splitted[0] == "tar" {
+		state, err = LoadTarball(ctx, splitted[1])
 	} else if splitted[0] == "bin" {
-		state, err = LoadBinary(splitted[1])
+		state, err = LoadBinary(ctx, splitted[1])
 	} else {
-		state, err = LoadEopkgRepo(splitted[1])
+		state, err = LoadEopkgRepo(ctx, splitted[1])
+	}
+
+	return
+}
+
+// LoadStates loads the state at every tpath. When more than one tpath is
+// given, they must all be source or tarball tpaths, and are merged into a single state
+// with MergeSources. The optional `jobs` is passed to LoadState.
+func LoadStates(ctx context.Context, tpaths []string, jobs ...int) (state State, err error) {
+	if len(tpaths) == 1 {
+		return LoadState(ctx, tpaths[0], jobs...)
+	}
+
+	var sources []*SourceState
+	for _, tpath := range tpaths {
+		if !strings.HasPrefix(tpath, "src:") && !strings.HasPrefix(tpath, "tar:") {
+			err = fmt.Errorf("Only source tpaths can be merged, got %s", tpath)
+			return
+		}
+
+		var source State
+		if source, err = LoadState(ctx, tpath, jobs...); err != nil {
+			err = fmt.Errorf("Failed to load %s: %w", tpath, err)
+			return
+		}
+		sources = append(sources, source.(*SourceState))
 	}
 
+	state = MergeSources(sources)
 	return
 }
 
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package state
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/ypkg"
+)
+
+func TestResolveProviders(t *testing.T) {
+	packages := []common.Package{
+		{Source: "qux", Names: []string{"qux-devel"}, Provides: []string{"pkgconfig(bar)", "libfoo"}},
+		{Source: "bar", Names: []string{"bar-devel"}, Provides: []string{"pkgconfig(bar)"}},
+		{Source: "foo", Names: []string{"foo-extra"}, Provides: []string{"libfoo"}},
+		{Source: "foo", Names: []string{"foo-devel"}, Provides: []string{"libfoo"}},
+		{Source: "baz", Names: []string{"baz"}, Provides: []string{"libbaz"}},
+	}
+	// The package each provider must resolve to, whatever the order of packages
+	tests := []struct {
+		pvd    string
+		source string
+		name   string
+	}{
+		// The package named after the provider wins over qux
+		{"pkgconfig(bar)", "bar", "bar-devel"},
+		// Then the source name, then the package name
+		{"libfoo", "foo", "foo-devel"},
+		{"libbaz", "baz", "baz"},
+	}
+
+	perms := [][]int{{0, 1, 2, 3, 4}, {4, 3, 2, 1, 0}, {2, 0, 4, 1, 3}, {1, 3, 0, 4, 2}}
+	for _, perm := range perms {
+		shuffled := make([]common.Package, len(perm))
+		for i, idx := range perm {
+			shuffled[i] = packages[idx]
+		}
+
+		pvdToPkgIdx, pvdToPkgIds := resolveProviders(shuffled)
+		for _, tt := range tests {
+			pkg := shuffled[pvdToPkgIdx[tt.pvd]]
+			if pkg.Source != tt.source || pkg.Names[0] != tt.name {
+				t.Errorf("order %v: %s resolves to %s, want %s{%s}", perm, tt.pvd, pkg.Show(true, false), tt.source, tt.name)
+			}
+			if ids := pvdToPkgIds[tt.pvd]; len(ids) == 0 || ids[0] != pvdToPkgIdx[tt.pvd] {
+				t.Errorf("order %v: providers of %s = %v, want %d first", perm, tt.pvd, ids, pvdToPkgIdx[tt.pvd])
+			}
+		}
+		if got := len(pvdToPkgIds["libfoo"]); got != 3 {
+			t.Errorf("order %v: libfoo has %d providers, want 3", perm, got)
+		}
+		if !slices.Contains(pvdToPkgIds["pkgconfig(bar)"], slices.IndexFunc(shuffled, func(pkg common.Package) bool { return pkg.Source == "qux" })) {
+			t.Errorf("order %v: qux is missing from the providers of pkgconfig(bar)", perm)
+		}
+	}
+}
+
+func BenchmarkLoadSource(b *testing.B) {
+	prev := ypkg.CacheEnabled
+	ypkg.CacheEnabled = false
+	b.Cleanup(func() { ypkg.CacheEnabled = prev })
+
+	dir := b.TempDir()
+	for i := 0; i < 500; i++ {
+		name := fmt.Sprintf("pkg%03d", i)
+		packageYml := fmt.Sprintf("name: %s\nversion: 1.0\nrelease: 1\ncomponent: programming\nbuilddeps:\n  - pkgconfig(zlib)\n  - pkg%03d-devel\n", name, (i+1)%500)
+		pspec := fmt.Sprintf("<PISI>\n<Package><Name>%s</Name><Files>\n</Files></Package>\n<Package><Name>%s-devel</Name><Files>\n</Files></Package>\n</PISI>\n", name, name)
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "package.yml"), []byte(packageYml), 0644); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "pspec_x86_64.xml"), []byte(pspec), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	counts := []int{1, 2, 4, runtime.GOMAXPROCS(0)}
+	slices.Sort(counts)
+	for _, jobs := range slices.Compact(counts) {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := LoadState(context.Background(), "src:"+dir, jobs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package state
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing/fstest"
+
+	"github.com/DataDrake/waterlog"
+	"github.com/GZGavinZhao/autobuild/common"
+	"github.com/GZGavinZhao/autobuild/config"
+)
+
+// readTarball reads the regular files of the tarball at `filename` into
+// memory. Tarballs ending with `.gz` or `.tgz` are decompressed with gzip.
+func readTarball(filename string) (fstest.MapFS, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if ext := filepath.Ext(filename); ext == ".gz" || ext == ".tgz" {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decompress %s: %w", filename, err)
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	files := make(fstest.MapFS)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %w", filename, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimLeft(path.Clean("/"+hdr.Name), "/")
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s from %s: %w", hdr.Name, filename, err)
+		}
+		files[name] = &fstest.MapFile{Data: data, Mode: fs.FileMode(hdr.Mode).Perm(), ModTime: hdr.ModTime}
+	}
+	return files, nil
+}
+
+// LoadTarball loads the source recipes in the tarball at `filename` without
+// extracting it, in the same way as LoadSource would load them from the
+// extracted directory. The paths of the packages point into the tarball, and
+// their root is left empty since there is no directory to go with it. Only
+// package.yml recipes are supported. Parsing stops early with the cause of
+// `ctx` as the error if it is cancelled.
+func LoadTarball(ctx context.Context, filename string) (state *SourceState, err error) {
+	state = &SourceState{}
+	state.pvdToPkgIdx = make(map[string]int)
+	state.srcToPkgIds = make(map[string][]int)
+
+	files, err := readTarball(filename)
+	if err != nil {
+		return
+	}
+
+	err = fs.WalkDir(files, ".", func(pkgpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		// Some hard-coded problematic packages
+		if slices.Contains(badPackages[:], path.Base(pkgpath)) {
+			return nil
+		}
+
+		for _, cfgFile := range []string{"autobuild.yaml", "autobuild.yml"} {
+			raw, err := files.Open(path.Join(pkgpath, cfgFile))
+			if err != nil {
+				continue
+			}
+			abConfig, err := config.Decode(raw)
+			raw.Close()
+			if err != nil {
+				return fmt.Errorf("LoadTarball: failed to load autobuild config file at %s: %w", path.Join(pkgpath, cfgFile), err)
+			}
+
+			if abConfig.Ignore {
+				return fs.SkipDir
+			}
+			break
+		}
+
+		if _, err := fs.Stat(files, path.Join(pkgpath, "package.yml")); err != nil {
+			if _, err := fs.Stat(files, path.Join(pkgpath, "stone.yaml")); err == nil {
+				waterlog.Warnf("Skipping stone recipe %s in %s, which is not supported in tarballs\n", pkgpath, filename)
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		pkgs, err := common.ParsePackageFS(files, pkgpath)
+		if err != nil {
+			return fmt.Errorf("Failed to parse %s: %w", path.Join(pkgpath, "package.yml"), err)
+		}
+		for i := range pkgs {
+			pkgs[i].Path = filepath.Join(filename, pkgpath)
+		}
+		state.packages = append(state.packages, pkgs...)
+
+		return fs.SkipDir
+	})
+
+	if err != nil {
+		return
+	}
+
+	state.index()
+	return
+}
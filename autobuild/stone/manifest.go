@@ -135,6 +135,7 @@ func ParseManifest(path string, abconfig config.AutobuildConfig) (cpkgs []common
 		// fmt.Println(cpkgs[idx].BuildDeps)
 		cpkgs[idx].BuildDeps = utils.Uniq2(cpkgs[idx].BuildDeps)
 		// fmt.Println(cpkgs[idx].BuildDeps)
+		cpkgs[idx].OwnBuildDeps = cpkgs[idx].BuildDeps
 
 		slices.Sort(cpkgs[idx].Provides)
 		cpkgs[idx].Provides = utils.Uniq2(cpkgs[idx].Provides)
@@ -9,7 +9,7 @@ import (
 	// "fmt"
 	"path/filepath"
 	_ "regexp"
-	// "slices"
+	"slices"
 
 	_ "github.com/DataDrake/waterlog"
 	"github.com/GZGavinZhao/autobuild/common"
@@ -84,13 +84,22 @@ func ParsePackage(path string, abconfig config.AutobuildConfig) (cpkgs []common.
 			BuildDeps: append(spkg.BuildDeps, spkg.CheckDeps...),
 			Synced:    false,
 		}
+		// The check step runs as part of the build, so the checkdeps stay in
+		// BuildDeps and are only told apart to mark their edges optional.
+		cpkg.CheckDeps = slices.DeleteFunc(slices.Clone(spkg.CheckDeps), func(dep string) bool {
+			return slices.Contains(spkg.BuildDeps, dep)
+		})
+		cpkg.OwnBuildDeps = slices.Clone(spkg.BuildDeps)
 
-		cpkg.BuildDeps = append(cpkg.BuildDeps, spkg.CollectRunDeps()...)
+		cpkg.RunDeps = spkg.CollectRunDeps()
+		cpkg.BuildDeps = append(cpkg.BuildDeps, cpkg.RunDeps...)
 
 		if spkg.Toolchain == "clang" {
 			cpkg.BuildDeps = append(cpkg.BuildDeps, "llvm-clang-devel")
+			cpkg.OwnBuildDeps = append(cpkg.OwnBuildDeps, "llvm-clang-devel")
 		} else if spkg.Toolchain == "gnu" {
 			cpkg.BuildDeps = append(cpkg.BuildDeps, "gcc-devel")
+			cpkg.OwnBuildDeps = append(cpkg.OwnBuildDeps, "gcc-devel")
 		}
 
 		cpkgs = append(cpkgs, cpkg)
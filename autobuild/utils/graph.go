@@ -74,6 +74,51 @@ func TieredTopSort(g graph.Iterator) ([][]int, bool) {
 	return res, vertexCount == g.Order()
 }
 
+// LexTopSort topologically sorts g using Kahn's algorithm, where an edge v -> w
+// means that v comes before w. Among the vertices that are ready at any point,
+// the smallest one according to `less` is picked first, so the order is fully
+// deterministic.
+//
+// The second return value is false if g has cycles, in which case the order
+// only contains the vertices that neither are part of nor depend on a cycle.
+func LexTopSort(g graph.Iterator, less func(int, int) int) ([]int, bool) {
+	indegree := make([]int, g.Order())
+	for v := range indegree {
+		g.Visit(v, func(w int, _ int64) (skip bool) {
+			indegree[w]++
+			return
+		})
+	}
+
+	// Invariant: this queue holds all unvisited vertices with indegree 0,
+	// sorted by `less`.
+	var queue []int
+	for v, degree := range indegree {
+		if degree == 0 {
+			queue = append(queue, v)
+		}
+	}
+	slices.SortFunc(queue, less)
+
+	order := make([]int, 0, g.Order())
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		order = append(order, v)
+
+		g.Visit(v, func(w int, _ int64) (skip bool) {
+			indegree[w]--
+			if indegree[w] == 0 {
+				pos, _ := slices.BinarySearchFunc(queue, w, less)
+				queue = slices.Insert(queue, pos, w)
+			}
+			return
+		})
+	}
+
+	return order, len(order) == g.Order()
+}
+
 func LiftGraph(g graph.Iterator, choose func(int) bool) (res *graph.Mutable) {
 	visited := make(map[int]bool)
 	res = graph.New(g.Order())
@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package utils
+
+import (
+	"cmp"
+	"slices"
+	"testing"
+
+	"github.com/yourbasic/graph"
+)
+
+// newGraph returns a graph with `order` vertices and the given edges.
+func newGraph(order int, edges [][2]int) *graph.Mutable {
+	g := graph.New(order)
+	for _, edge := range edges {
+		g.Add(edge[0], edge[1])
+	}
+	return g
+}
+
+func TestLexTopSort(t *testing.T) {
+	tests := []struct {
+		name  string
+		order int
+		edges [][2]int
+		less  func(int, int) int
+		want  []int
+		ok    bool
+	}{
+		{
+			name:  "empty",
+			order: 0,
+			want:  []int{},
+			ok:    true,
+		},
+		{
+			name:  "no edges",
+			order: 3,
+			want:  []int{0, 1, 2},
+			ok:    true,
+		},
+		{
+			name:  "chain",
+			order: 3,
+			edges: [][2]int{{2, 1}, {1, 0}},
+			want:  []int{2, 1, 0},
+			ok:    true,
+		},
+		{
+			name:  "ties picked in order",
+			order: 4,
+			edges: [][2]int{{3, 0}, {1, 0}, {2, 0}},
+			want:  []int{1, 2, 3, 0},
+			ok:    true,
+		},
+		{
+			name:  "ties picked by less",
+			order: 4,
+			edges: [][2]int{{3, 0}, {1, 0}, {2, 0}},
+			less:  func(a, b int) int { return cmp.Compare(b, a) },
+			want:  []int{3, 2, 1, 0},
+			ok:    true,
+		},
+		{
+			name:  "ready vertex picked before later ones",
+			order: 4,
+			edges: [][2]int{{1, 0}, {2, 3}},
+			want:  []int{1, 0, 2, 3},
+			ok:    true,
+		},
+		{
+			name:  "cycle",
+			order: 4,
+			edges: [][2]int{{0, 1}, {1, 2}, {2, 1}, {1, 3}},
+			want:  []int{0},
+			ok:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			less := tt.less
+			if less == nil {
+				less = cmp.Compare[int]
+			}
+			got, ok := LexTopSort(newGraph(tt.order, tt.edges), less)
+			if !slices.Equal(got, tt.want) || ok != tt.ok {
+				t.Errorf("LexTopSort() = %v, %t, want %v, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTieredTopSort(t *testing.T) {
+	tests := []struct {
+		name  string
+		order int
+		edges [][2]int
+		want  [][]int
+		ok    bool
+	}{
+		{
+			name:  "empty",
+			order: 0,
+			ok:    true,
+		},
+		{
+			name:  "no edges",
+			order: 3,
+			want:  [][]int{{0, 1, 2}},
+			ok:    true,
+		},
+		{
+			name:  "chain",
+			order: 3,
+			edges: [][2]int{{2, 1}, {1, 0}},
+			want:  [][]int{{2}, {1}, {0}},
+			ok:    true,
+		},
+		{
+			name:  "diamond",
+			order: 4,
+			edges: [][2]int{{3, 1}, {3, 2}, {1, 0}, {2, 0}},
+			want:  [][]int{{3}, {1, 2}, {0}},
+			ok:    true,
+		},
+		{
+			name:  "vertex in the tier after its last dependency",
+			order: 4,
+			edges: [][2]int{{0, 1}, {1, 2}, {0, 2}, {3, 2}},
+			want:  [][]int{{0, 3}, {1}, {2}},
+			ok:    true,
+		},
+		{
+			name:  "cycle",
+			order: 4,
+			edges: [][2]int{{0, 1}, {1, 2}, {2, 1}, {3, 0}},
+			want:  [][]int{{3}, {0}},
+			ok:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := TieredTopSort(newGraph(tt.order, tt.edges))
+			if !slices.EqualFunc(got, tt.want, slices.Equal[[]int]) || ok != tt.ok {
+				t.Errorf("TieredTopSort() = %v, %t, want %v, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -5,11 +5,40 @@
 package utils
 
 import (
+	"bufio"
 	"errors"
+	"io"
 	"os"
+	"strings"
 )
 
 func PathExists(filePath string) bool {
 	_, err := os.Stat(filePath)
 	return !errors.Is(err, os.ErrNotExist)
 }
+
+// ReadPackageList reads one name per line from `r`. Surrounding whitespace is
+// trimmed, and empty lines as well as lines starting with '#' are skipped.
+func ReadPackageList(r io.Reader) (res []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res = append(res, line)
+	}
+	err = scanner.Err()
+	return
+}
+
+// ReadPackageListFile is ReadPackageList on the file at `path`.
+func ReadPackageListFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadPackageList(file)
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/DataDrake/waterlog"
+)
+
+var (
+	// ProfilingEnabled controls whether phases and counts are recorded at
+	// all, see TrackPhase and RecordPeak.
+	ProfilingEnabled = false
+
+	profileMutex sync.Mutex
+	// phases are the names of the tracked phases, in the order in which they
+	// were first tracked.
+	phases     []string
+	phaseTimes = make(map[string]time.Duration)
+	// peaks are the names of the recorded counts, in the order in which they
+	// were first recorded.
+	peaks      []string
+	peakCounts = make(map[string]int)
+)
+
+// TrackPhase starts timing the phase `name` and returns the function that
+// stops it, e.g. `defer utils.TrackPhase("Loading state")()`. The times of all
+// runs of a phase add up. Does nothing unless ProfilingEnabled is set.
+func TrackPhase(name string) func() {
+	if !ProfilingEnabled {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		profileMutex.Lock()
+		defer profileMutex.Unlock()
+		if _, found := phaseTimes[name]; !found {
+			phases = append(phases, name)
+		}
+		phaseTimes[name] += elapsed
+	}
+}
+
+// RecordPeak records `count` for `name`, keeping the highest count recorded
+// for it. Does nothing unless ProfilingEnabled is set.
+func RecordPeak(name string, count int) {
+	if !ProfilingEnabled {
+		return
+	}
+
+	profileMutex.Lock()
+	defer profileMutex.Unlock()
+	if prev, found := peakCounts[name]; !found {
+		peaks = append(peaks, name)
+	} else if prev >= count {
+		return
+	}
+	peakCounts[name] = count
+}
+
+// ReportProfile logs the time spent in every tracked phase and every peak
+// count, and writes a pprof heap profile to `path`.
+func ReportProfile(path string) error {
+	profileMutex.Lock()
+	for _, name := range phases {
+		waterlog.Infof("Time spent %s: %s\n", name, phaseTimes[name].Round(time.Millisecond))
+	}
+	for _, name := range peaks {
+		waterlog.Infof("Peak %s: %d\n", name, peakCounts[name])
+	}
+	profileMutex.Unlock()
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	waterlog.Infof("Heap obtained from the OS: %d MiB, allocated in total: %d MiB\n", stats.HeapSys>>20, stats.TotalAlloc>>20)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Failed to create memory profile: %w", err)
+	}
+	defer f.Close()
+
+	// Get up-to-date statistics for the profile
+	runtime.GC()
+	if err = pprof.WriteHeapProfile(f); err != nil {
+		return fmt.Errorf("Failed to write memory profile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ProgressEnabled controls whether progress is reported at all. Progress
+	// is never reported when stderr is not a terminal.
+	ProgressEnabled = true
+)
+
+// progressInterval is the minimum time between two redraws of the progress
+// line.
+const progressInterval = 100 * time.Millisecond
+
+// Progress reports the progress of a long-running operation on a single line
+// of stderr. It is safe for concurrent use.
+type Progress struct {
+	label   string
+	total   int
+	enabled bool
+
+	mutex sync.Mutex
+	done  int
+	start time.Time
+	drawn time.Time
+}
+
+// NewProgress starts reporting the progress of the operation described by
+// `label`, which consists of `total` steps. If `total` is not positive, only
+// the number of completed steps is reported.
+func NewProgress(label string, total int) *Progress {
+	return &Progress{
+		label:   label,
+		total:   total,
+		enabled: ProgressEnabled && isTerminal(os.Stderr),
+		start:   time.Now(),
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Increment marks one more step as completed.
+func (p *Progress) Increment() {
+	if !p.enabled {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.done++
+	now := time.Now()
+	if now.Sub(p.drawn) < progressInterval && p.done != p.total {
+		return
+	}
+	p.drawn = now
+
+	if p.total <= 0 {
+		fmt.Fprintf(os.Stderr, "\r\033[K%s: %d", p.label, p.done)
+		return
+	}
+
+	// Assume that the remaining steps take as long as the completed ones
+	elapsed := now.Sub(p.start)
+	eta := time.Duration(float64(elapsed) / float64(p.done) * float64(p.total-p.done))
+	fmt.Fprintf(os.Stderr, "\r\033[K%s: %d/%d (%d%%), ETA %s", p.label, p.done, p.total, p.done*100/p.total, eta.Round(time.Second))
+}
+
+// Finish clears the progress line.
+func (p *Progress) Finish() {
+	if !p.enabled {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	fmt.Fprint(os.Stderr, "\r\033[K")
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package ypkg
+
+import (
+	"encoding/gob"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/zeebo/blake3"
+)
+
+var (
+	// CacheEnabled controls whether Load consults and updates the on-disk
+	// cache of parsed package.yml files.
+	CacheEnabled = true
+)
+
+// cacheVersion must be bumped whenever PackageYML changes, so that entries
+// written by older versions are not reused.
+const cacheVersion = 2
+
+// cacheEntry is what gets stored on disk for every cached package.yml. The
+// entry is only valid as long as the file still has the same modification
+// time and size.
+type cacheEntry struct {
+	Version int
+	Path    string
+	ModTime int64
+	Size    int64
+	Pkg     PackageYML
+}
+
+// CacheDir returns the directory that holds the cache, which is
+// `$XDG_CACHE_HOME/autobuild` on Linux.
+func CacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "autobuild"), nil
+}
+
+// ClearCache removes every cached package.yml.
+func ClearCache() error {
+	dir, err := CacheDir()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func cachePath(path string) (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := blake3.Sum256([]byte(path))
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])+".gob"), nil
+}
+
+// loadCached returns the cached parse result for the file at `path`, if there
+// is one that still matches `info`.
+func loadCached(path string, info os.FileInfo) (pkg PackageYML, ok bool) {
+	file, err := cachePath(path)
+	if err != nil {
+		return
+	}
+
+	raw, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer raw.Close()
+
+	var entry cacheEntry
+	if err = gob.NewDecoder(raw).Decode(&entry); err != nil {
+		return
+	}
+	if entry.Version != cacheVersion || entry.Path != path || entry.ModTime != info.ModTime().UnixNano() || entry.Size != info.Size() {
+		return
+	}
+
+	return entry.Pkg, true
+}
+
+// storeCached writes the parse result for the file at `path` into the cache.
+// The entry is written to a temporary file first and then renamed, so that
+// concurrent loads never see a partially written entry.
+func storeCached(path string, info os.FileInfo, pkg PackageYML) error {
+	file, err := cachePath(path)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = gob.NewEncoder(tmp).Encode(cacheEntry{
+		Version: cacheVersion,
+		Path:    path,
+		ModTime: info.ModTime().UnixNano(),
+		Size:    info.Size(),
+		Pkg:     pkg,
+	})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package ypkg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const cacheRecipe = `name: foo
+version: 1.2.3
+release: 4
+component:
+    - programming.library
+    - ^foo-devel : programming.devel
+builddeps:
+    - pkgconfig(zlib)
+    - pkgconfig32(zlib)
+rundeps:
+    - devel:
+        - zlib-devel
+build: |
+    %make
+`
+
+// writeCacheRecipe writes a package.yml to a temporary directory, and points
+// the cache at another one, so that the tests don't touch the cache of the
+// user.
+func writeCacheRecipe(t testing.TB) string {
+	t.Helper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "package.yml")
+	if err := os.WriteFile(path, []byte(cacheRecipe), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setCacheEnabled sets CacheEnabled until the end of the test.
+func setCacheEnabled(t testing.TB, enabled bool) {
+	prev := CacheEnabled
+	CacheEnabled = enabled
+	t.Cleanup(func() { CacheEnabled = prev })
+}
+
+func TestLoadCached(t *testing.T) {
+	path := writeCacheRecipe(t)
+	setCacheEnabled(t, false)
+	want, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %s", path, err)
+	}
+
+	setCacheEnabled(t, true)
+	for i := 0; i < 2; i++ {
+		got, err := Load(path)
+		if err != nil {
+			t.Fatalf("Failed to load %s: %s", path, err)
+		}
+		if got.Name != want.Name || got.Version != want.Version || !reflect.DeepEqual(got.BuildDeps, want.BuildDeps) || !reflect.DeepEqual(got.CollectRunDeps(), want.CollectRunDeps()) {
+			t.Errorf("load %d = %+v, want %+v", i, got, want)
+		}
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loadCached(abs, info); !ok {
+		t.Fatalf("%s is not cached after loading it", path)
+	}
+
+	// Modifying the file must invalidate its entry
+	if err = os.WriteFile(path, []byte(cacheRecipe+"networking: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := info.ModTime().Add(time.Second)
+	if err = os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load %s: %s", path, err)
+	}
+	if !got.Networking {
+		t.Errorf("stale cache entry used after modifying %s", path)
+	}
+}
+
+func BenchmarkLoad(b *testing.B) {
+	b.Run("uncached", func(b *testing.B) {
+		path := writeCacheRecipe(b)
+		setCacheEnabled(b, false)
+		for i := 0; i < b.N; i++ {
+			if _, err := Load(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("miss", func(b *testing.B) {
+		path := writeCacheRecipe(b)
+		setCacheEnabled(b, true)
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			if err := ClearCache(); err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+			if _, err := Load(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("hit", func(b *testing.B) {
+		path := writeCacheRecipe(b)
+		setCacheEnabled(b, true)
+		if _, err := Load(path); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := Load(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
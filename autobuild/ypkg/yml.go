@@ -5,8 +5,12 @@
 package ypkg
 
 import (
-	"gopkg.in/yaml.v3"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
 type PackageYML struct {
@@ -24,15 +28,134 @@ type PackageYML struct {
 	Install     string    `yaml:"install"`
 	Networking  bool      `yaml:"networking"`
 	Clang       bool      `yaml:"clang"`
+	Emul32      bool      `yaml:"emul32"`
+}
+
+// SplitConstraint splits a dependency such as `pkgconfig(foo) >= 1.2` into the
+// provider it refers to and its version constraint, which is empty if there is
+// none.
+func SplitConstraint(dep string) (name string, constraint string) {
+	idx := strings.IndexAny(dep, " \t<>=!")
+	if idx < 0 {
+		return dep, ""
+	}
+	return dep[:idx], strings.TrimSpace(dep[idx:])
+}
+
+// IsEmul32Dep reports whether `dep` is only needed for the 32-bit (emul32)
+// build of a package, i.e. it is a `pkgconfig32()` provider or a `-32bit`
+// package.
+func IsEmul32Dep(dep string) bool {
+	return strings.HasPrefix(dep, "pkgconfig32(") || strings.Contains(dep, "-32bit")
+}
+
+// Emul32BuildDeps returns the build dependencies that are only needed for the
+// 32-bit build of the package, without their version constraints. Packages
+// without an emul32 build need all of their build dependencies, so none are
+// returned for them.
+func (p *PackageYML) Emul32BuildDeps() (res []string) {
+	if !p.Emul32 {
+		return
+	}
+	for _, dep := range p.BuildDeps {
+		if name, _ := SplitConstraint(dep); IsEmul32Dep(name) {
+			res = append(res, name)
+		}
+	}
+	return
+}
+
+// Components returns the components listed in the `component` field, in order
+// of appearance. The field is either a single component, a mapping from
+// subpackages to components (like ^libgcc : system.base), or a list of any of
+// these.
+func (p *PackageYML) Components() []string {
+	return componentNames(p.Component)
+}
+
+func componentNames(component yaml.Node) (res []string) {
+	switch component.Kind {
+	case yaml.ScalarNode:
+		if component.Value != "" {
+			res = append(res, component.Value)
+		}
+	case yaml.MappingNode:
+		// Only the values are components, the keys are subpackages.
+		for idx := 1; idx < len(component.Content); idx += 2 {
+			res = append(res, componentNames(*component.Content[idx])...)
+		}
+	case yaml.SequenceNode:
+		for _, node := range component.Content {
+			res = append(res, componentNames(*node)...)
+		}
+	}
+	return
 }
 
+// CollectRunDeps combines the rundeps of the package and all of its
+// subpackages into a single list.
+//
+// Note to self: this website can inspect yaml ast nodes:
+// https://astexplorer.net/, might be useful when debugging
+func (p *PackageYML) CollectRunDeps() (res []string) {
+	if p.RunDeps.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for _, children := range p.RunDeps.Content {
+		if children.Kind == yaml.ScalarNode {
+			res = append(res, children.Value)
+		} else if children.Kind == yaml.MappingNode {
+			for _, subpkg := range children.Content {
+				for _, rundep := range subpkg.Content {
+					if rundep.Kind != yaml.ScalarNode {
+						continue
+					}
+
+					res = append(res, rundep.Value)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// Decode parses a package.yml from `r`.
+func Decode(r io.Reader) (pkg PackageYML, err error) {
+	err = yaml.NewDecoder(r).Decode(&pkg)
+	return
+}
+
+// Load parses the package.yml at `path`. When CacheEnabled is set, the result
+// is cached on disk and reused until the file's modification time or size
+// changes.
 func Load(path string) (pkg PackageYML, err error) {
+	var info os.FileInfo
+	if CacheEnabled {
+		if path, err = filepath.Abs(path); err != nil {
+			return
+		}
+		if info, err = os.Stat(path); err != nil {
+			return
+		}
+		if cached, ok := loadCached(path, info); ok {
+			return cached, nil
+		}
+	}
+
 	raw, err := os.Open(path)
 	if err != nil {
 		return
 	}
 	defer raw.Close()
-	dec := yaml.NewDecoder(raw)
-	err = dec.Decode(&pkg)
+	if pkg, err = Decode(raw); err != nil {
+		return
+	}
+
+	if CacheEnabled {
+		// Failing to cache is not a reason to fail loading.
+		_ = storeCached(path, info, pkg)
+	}
 	return
 }
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: Copyright © 2020-2023 Serpent OS Developers
+//
+// SPDX-License-Identifier: MPL-2.0
+
+package ypkg
+
+import (
+	"slices"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestComponents(t *testing.T) {
+	tests := []struct {
+		name string
+		yml  string
+		want []string
+	}{
+		{"missing", "name: foo\n", nil},
+		{"empty", "component: \"\"\n", nil},
+		{"scalar", "component: system.base\n", []string{"system.base"}},
+		{"mapping", "component:\n  - ^libgcc : system.base\n  - ^gcc : system.devel\n", []string{"system.base", "system.devel"}},
+		{"bare mapping", "component:\n  ^libgcc : system.base\n  ^gcc : system.devel\n", []string{"system.base", "system.devel"}},
+		{"sequence", "component:\n  - programming.tools\n  - system.devel\n", []string{"programming.tools", "system.devel"}},
+		{"mixed", "component:\n  - programming\n  - ^foo-devel : system.devel\n", []string{"programming", "system.devel"}},
+	}
+
+	for _, tt := range tests {
+		var pkgYml PackageYML
+		if err := yaml.Unmarshal([]byte(tt.yml), &pkgYml); err != nil {
+			t.Fatalf("%s: failed to parse %q: %s", tt.name, tt.yml, err)
+		}
+		if got := pkgYml.Components(); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Components() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsEmul32Dep(t *testing.T) {
+	tests := []struct {
+		dep  string
+		want bool
+	}{
+		{"pkgconfig32(zlib)", true},
+		{"zlib-32bit-devel", true},
+		{"glibc-32bit", true},
+		{"pkgconfig(zlib)", false},
+		{"zlib-devel", false},
+		{"pkgconfig(x32bit)", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsEmul32Dep(tt.dep); got != tt.want {
+			t.Errorf("IsEmul32Dep(%q) = %t, want %t", tt.dep, got, tt.want)
+		}
+	}
+}